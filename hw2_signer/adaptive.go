@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter подбирает число одновременно обрабатываемых элементов
+// стадии по принципу AIMD с учётом задержки и пропускной способности.
+// Пока все слоты заняты и задержка близка к лучшей наблюдаемой, лимит
+// растёт на 1. Если задержка выросла больше чем в Tolerance раз, смотрим
+// на пропускную способность: выросла по сравнению с прошлым окном хотя бы
+// на MinGain - лишняя параллельность окупается, лимит растёт дальше; нет -
+// элементы только дольше ждут друг друга, и лимит умножается на Backoff.
+// Решение принимается раз в окно из max(Window, лимит) завершённых элементов.
+type AdaptiveLimiter struct {
+	Min, Max  int
+	Tolerance float64
+	Backoff   float64
+	MinGain   float64
+	Window    int
+	Clock     Clock
+
+	// DeadLetters получает элементы, на которых упала стадия в AdaptiveStage,
+	// по умолчанию (nil) - лог.
+	DeadLetters DeadLetterSink
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	limit       int
+	inFlight    int
+	maxInFlight int
+	minLatency  time.Duration
+	samples     int
+	latencySum  time.Duration
+	windowStart time.Time
+	// prevThroughput - пропускная способность прошлого окна
+	prevThroughput float64
+	decisions      []LimiterDecision
+}
+
+// LimiterDecision - одно изменение лимита и то, на основании чего оно принято.
+type LimiterDecision struct {
+	Time       time.Time
+	OldLimit   int
+	NewLimit   int
+	Latency    time.Duration // средняя задержка за окно
+	MinLatency time.Duration
+	Throughput float64 // элементов в секунду за окно
+	Reason     string
+}
+
+func (d LimiterDecision) String() string {
+	return fmt.Sprintf("%d -> %d: %s (latency %s, min %s, %.1f/s)",
+		d.OldLimit, d.NewLimit, d.Reason, d.Latency, d.MinLatency, d.Throughput)
+}
+
+// NewAdaptiveLimiter создаёт лимитер с лимитом в пределах [min, max],
+// начиная с min.
+func NewAdaptiveLimiter(min, max int) *AdaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &AdaptiveLimiter{
+		Min:       min,
+		Max:       max,
+		Tolerance: 1.5,
+		Backoff:   0.75,
+		MinGain:   0.1,
+		Window:    10,
+		limit:     min,
+	}
+}
+
+// init доводит до рабочего состояния лимитер, созданный без
+// NewAdaptiveLimiter: с нулевым лимитом Acquire ждал бы вечно.
+func (l *AdaptiveLimiter) init() {
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.mu)
+	}
+	if l.Min < 1 {
+		l.Min = 1
+	}
+	if l.Max < l.Min {
+		l.Max = l.Min
+	}
+	if l.limit == 0 {
+		l.limit = l.Min
+	}
+}
+
+func (l *AdaptiveLimiter) now() time.Time {
+	if l.Clock == nil {
+		return time.Now()
+	}
+	return l.Clock.Now()
+}
+
+// Acquire ждёт свободный слот и возвращает время начала обработки,
+// которое надо передать в Release.
+func (l *AdaptiveLimiter) Acquire() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	if l.inFlight > l.maxInFlight {
+		l.maxInFlight = l.inFlight
+	}
+	start := l.now()
+	if l.windowStart.IsZero() {
+		l.windowStart = start
+	}
+	return start
+}
+
+// Release освобождает слот и учитывает задержку элемента.
+func (l *AdaptiveLimiter) Release(start time.Time) {
+	end := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.samples++
+	l.latencySum += end.Sub(start)
+
+	window := l.Window
+	if l.limit > window {
+		window = l.limit
+	}
+	if l.samples >= window {
+		l.decide(end)
+	}
+	l.cond.Broadcast()
+}
+
+func (l *AdaptiveLimiter) decide(now time.Time) {
+	latency := l.latencySum / time.Duration(l.samples)
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+	}
+	var throughput float64
+	if elapsed := now.Sub(l.windowStart); elapsed > 0 {
+		throughput = float64(l.samples) / elapsed.Seconds()
+	}
+
+	slow := float64(latency) > float64(l.minLatency)*l.Tolerance
+	gained := throughput > l.prevThroughput*(1+l.MinGain)
+
+	newLimit, reason := l.limit, ""
+	switch {
+	case slow && !gained:
+		newLimit = int(float64(l.limit) * l.Backoff)
+		reason = fmt.Sprintf("latency above %.2fx of min without throughput gain, decrease", l.Tolerance)
+	case l.maxInFlight < l.limit:
+	case slow:
+		newLimit = l.limit + 1
+		reason = "saturated, throughput grows despite latency, increase"
+	default:
+		newLimit = l.limit + 1
+		reason = "saturated with good latency, increase"
+	}
+	if newLimit < l.Min {
+		newLimit = l.Min
+	}
+	if newLimit > l.Max {
+		newLimit = l.Max
+	}
+	if newLimit != l.limit {
+		l.decisions = append(l.decisions, LimiterDecision{
+			Time:       now,
+			OldLimit:   l.limit,
+			NewLimit:   newLimit,
+			Latency:    latency,
+			MinLatency: l.minLatency,
+			Throughput: throughput,
+			Reason:     reason,
+		})
+		l.limit = newLimit
+	}
+
+	l.prevThroughput = throughput
+	l.samples = 0
+	l.latencySum = 0
+	l.maxInFlight = l.inFlight
+	l.windowStart = now
+}
+
+// Limit - текущий лимит.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	return l.limit
+}
+
+// Decisions возвращает все изменения лимита, чтобы понять, почему
+// стадия работала с той или иной параллельностью.
+func (l *AdaptiveLimiter) Decisions() []LimiterDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]LimiterDecision(nil), l.decisions...)
+}
+
+// AdaptiveStage оборачивает поэлементную стадию так, что одновременно
+// обрабатывается не больше l.Limit() элементов.
+func AdaptiveStage(l *AdaptiveLimiter, jb job) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		for data := range in {
+			data := data
+			start := l.Acquire()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				outputs, err := runItem(jb, data)
+				l.Release(start)
+				if err != nil {
+					putDeadLetter(l.DeadLetters, "AdaptiveStage", data, err)
+					return
+				}
+				for _, val := range outputs {
+					out <- val
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// simulateLimiter прогоняет n элементов через лимитер по виртуальным
+// часам: элемент стартует, как только есть свободный слот, и выполняется
+// latency(k), где k - сколько элементов в работе вместе с ним на старте.
+// Возвращает наибольший лимит за прогон.
+func simulateLimiter(l *AdaptiveLimiter, clock *FakeClock, n int, latency func(k int) time.Duration) int {
+	type item struct{ start, end time.Time }
+	var running []item
+	maxLimit := l.Limit()
+	for started := 0; started < n || len(running) > 0; {
+		for started < n && len(running) < l.Limit() {
+			start := l.Acquire()
+			running = append(running, item{start, start.Add(latency(len(running) + 1))})
+			started++
+		}
+		if limit := l.Limit(); limit > maxLimit {
+			maxLimit = limit
+		}
+		next := 0
+		for i := range running {
+			if running[i].end.Before(running[next].end) {
+				next = i
+			}
+		}
+		clock.Advance(running[next].end.Sub(clock.Now()))
+		l.Release(running[next].start)
+		running = append(running[:next], running[next+1:]...)
+	}
+	return maxLimit
+}
+
+func newTestLimiter(min, max int) (*AdaptiveLimiter, *FakeClock) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := NewAdaptiveLimiter(min, max)
+	l.Clock = clock
+	return l, clock
+}
+
+func hasDecision(l *AdaptiveLimiter, reason string) bool {
+	for _, d := range l.Decisions() {
+		if strings.Contains(d.Reason, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAdaptiveLimiterIndependent(t *testing.T) {
+	// независимые элементы: задержка не зависит от параллельности
+	l, clock := newTestLimiter(1, 8)
+	simulateLimiter(l, clock, 300, func(k int) time.Duration { return 2 * time.Millisecond })
+	if l.Limit() != 8 {
+		t.Errorf("expected limit 8, got %d\n%v", l.Limit(), l.Decisions())
+	}
+	if hasDecision(l, "decrease") {
+		t.Errorf("unexpected decrease\n%v", l.Decisions())
+	}
+	for _, d := range l.Decisions() {
+		if d.NewLimit < l.Min || d.NewLimit > l.Max {
+			t.Errorf("decision out of bounds: %s", d)
+		}
+	}
+}
+
+func TestAdaptiveLimiterSerialized(t *testing.T) {
+	// как syncMd5: пропускная способность постоянна, растёт только задержка
+	l, clock := newTestLimiter(1, 16)
+	maxLimit := simulateLimiter(l, clock, 300, func(k int) time.Duration { return time.Duration(k) * time.Millisecond })
+	// на 2 задержка уже вдвое выше минимальной, а пропускная способность та же
+	if maxLimit > 2 {
+		t.Errorf("serialized stage should stay at low concurrency, max limit %d\n%v", maxLimit, l.Decisions())
+	}
+	if !hasDecision(l, "without throughput gain, decrease") {
+		t.Errorf("expected a decrease decision, got %v", l.Decisions())
+	}
+}
+
+func TestAdaptiveLimiterThroughput(t *testing.T) {
+	// задержка и пропускная способность растут как sqrt(k): с k = 3 задержка
+	// выше 1.5x минимальной, и по одной задержке лимит выше 3 не поднялся бы,
+	// но пропускная способность растёт больше чем на 10% до k = 5
+	l, clock := newTestLimiter(1, 16)
+	maxLimit := simulateLimiter(l, clock, 500, func(k int) time.Duration {
+		return time.Duration(float64(time.Millisecond) * math.Sqrt(float64(k)))
+	})
+	if maxLimit != 5 {
+		t.Errorf("expected max limit 5, got %d\n%v", maxLimit, l.Decisions())
+	}
+	if !hasDecision(l, "throughput grows despite latency") {
+		t.Errorf("expected an increase driven by throughput, got %v", l.Decisions())
+	}
+	for _, d := range l.Decisions() {
+		if d.Throughput <= 0 {
+			t.Errorf("decision without throughput: %s", d)
+		}
+	}
+}
+
+func TestAdaptiveStage(t *testing.T) {
+	l, _ := newTestLimiter(1, 4)
+	input := make([]int, 100)
+	for i := range input {
+		input[i] = i
+	}
+	count := 0
+	ExecutePipeline(
+		intSource(input...),
+		AdaptiveStage(l, func(in, out chan interface{}) {
+			for val := range in {
+				out <- val
+			}
+		}),
+		func(in, out chan interface{}) {
+			for range in {
+				count++
+			}
+		},
+	)
+	if count != len(input) {
+		t.Errorf("lost items: got %d", count)
+	}
+	if limit := l.Limit(); limit < l.Min || limit > l.Max {
+		t.Errorf("limit out of bounds: %d", limit)
+	}
+}
+
+func TestAdaptiveLimiterZeroValue(t *testing.T) {
+	l := &AdaptiveLimiter{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Release(l.Acquire())
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire blocked on zero limiter")
+	}
+	if l.Limit() != 1 || l.Min != 1 || l.Max != 1 {
+		t.Errorf("unexpected limits: limit %d, min %d, max %d", l.Limit(), l.Min, l.Max)
+	}
+}
+
+func TestAdaptiveStageErrors(t *testing.T) {
+	l, _ := newTestLimiter(1, 4)
+	queue := &DeadLetterQueue{}
+	l.DeadLetters = queue
+	count := 0
+	ExecutePipeline(
+		intSource(1, 2, 3),
+		AdaptiveStage(l, func(in, out chan interface{}) {
+			for val := range in {
+				if val.(int) == 2 {
+					panic("boom")
+				}
+				out <- val
+			}
+		}),
+		func(in, out chan interface{}) {
+			for range in {
+				count++
+			}
+		},
+	)
+	if count != 2 || queue.Len() != 1 || queue.Items()[0].Value != 2 {
+		t.Errorf("expected 2 results and 1 dead letter, got %d:\n%s", count, queue.Report())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для Signer и AdaptiveLimiter.
+// В тестах его можно подменить на FakeClock, чтобы не ждать реальные секунды.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock - виртуальные часы: Sleep блокируется, пока время не будет
+// продвинуто через Advance или AdvanceToNext. Тест сам решает, когда
+// двигать время: ждёт через BlockUntil, пока уснёт известное число
+// горутин, и продвигает часы - без опоры на реальное время.
+type FakeClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleepers []*fakeSleeper
+}
+
+type fakeSleeper struct {
+	until time.Time
+	wake  chan struct{}
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	s := &fakeSleeper{until: c.now.Add(d), wake: make(chan struct{})}
+	c.sleepers = append(c.sleepers, s)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	<-s.wake
+}
+
+// Sleepers - сколько горутин сейчас спит.
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// BlockUntil ждёт, пока спящих горутин станет не меньше n.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.sleepers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Advance продвигает время на d и будит всех, чей срок подошёл.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(c.now.Add(d))
+}
+
+// AdvanceToNext переводит время на ближайший срок пробуждения.
+// Возвращает false, если никто не спит.
+func (c *FakeClock) AdvanceToNext() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.sleepers) == 0 {
+		return false
+	}
+	next := c.sleepers[0].until
+	for _, s := range c.sleepers[1:] {
+		if s.until.Before(next) {
+			next = s.until
+		}
+	}
+	if next.After(c.now) {
+		c.setLocked(next)
+	} else {
+		c.setLocked(c.now)
+	}
+	return true
+}
+
+func (c *FakeClock) setLocked(now time.Time) {
+	c.now = now
+	sleepers := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.until.After(now) {
+			sleepers = append(sleepers, s)
+		} else {
+			close(s.wake)
+		}
+	}
+	c.sleepers = sleepers
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var woken int32
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		d := d
+		go func() {
+			clock.Sleep(d)
+			atomic.AddInt32(&woken, 1)
+		}()
+	}
+	clock.BlockUntil(2)
+
+	clock.Advance(500 * time.Millisecond)
+	if clock.Sleepers() != 2 {
+		t.Errorf("woke up too early")
+	}
+	clock.AdvanceToNext()
+	if clock.Sleepers() != 1 || !clock.Now().Equal(time.Unix(1, 0)) {
+		t.Errorf("expected one sleeper at 1s, got %d at %v", clock.Sleepers(), clock.Now())
+	}
+	clock.Advance(time.Hour)
+	if clock.Sleepers() != 0 {
+		t.Errorf("expected all sleepers woken")
+	}
+	if clock.AdvanceToNext() {
+		t.Errorf("AdvanceToNext without sleepers")
+	}
+}
+
+// runSigner прогоняет input через SingleHash, MultiHash и CombineResults
+// signer и двигает его часы шаг за шагом. На каждом шаге известно, сколько
+// горутин должно спать, поэтому результат не зависит от планировщика.
+// Можно вызывать из нескольких горутин теста:
+//
+//	0..n*10мс    md5 по очереди: n crc32(data), k crc32(md5) и один md5
+//	1с           просыпаются все crc32(data), остаются n crc32(md5)
+//	1с+k*10мс    k-й SingleHash готов, его MultiHash запускает 6 crc32
+//	2с+k*10мс    k-й MultiHash готов
+func runSigner(t *testing.T, signer *Signer, clock *FakeClock, input ...int) string {
+	result := "NOT_SET"
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExecutePipeline(
+			intSource(input...),
+			signer.SingleHash,
+			signer.MultiHash,
+			signer.CombineResults,
+			func(in, out chan interface{}) {
+				result = (<-in).(string)
+			},
+		)
+	}()
+
+	n := len(input)
+	var schedule []int
+	for k := 0; k < n; k++ {
+		schedule = append(schedule, n+k+1)
+	}
+	schedule = append(schedule, 2*n)
+	for k := 1; k <= n; k++ {
+		schedule = append(schedule, n-k+1+6*(k-1))
+	}
+	for k := 1; k <= n; k++ {
+		schedule = append(schedule, 6*(n-k+1))
+	}
+	for _, sleepers := range schedule {
+		clock.BlockUntil(sleepers)
+		if got := clock.Sleepers(); got != sleepers {
+			t.Errorf("at %v: expected %d sleepers, got %d", clock.Now(), sleepers, got)
+			return ""
+		}
+		clock.AdvanceToNext()
+	}
+	<-done
+	return result
+}
+
+func TestSignerVirtualClock(t *testing.T) {
+	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	start := clock.Now()
+	testResult := runSigner(t, &Signer{Clock: clock}, clock, 0, 1, 1, 2, 3, 5, 8)
+	elapsed := clock.Now().Sub(start)
+
+	if testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+	// 7 последовательных md5 по 10мс, затем crc32 в SingleHash и в MultiHash по 1с
+	if expected := 2*time.Second + 70*time.Millisecond; elapsed != expected {
+		t.Errorf("unexpected virtual time\nGot: %s\nExpected: %s", elapsed, expected)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// DefaultRunSize - сколько хешей держим в памяти, прежде чем
+// сбросить отсортированный кусок во временный файл.
+const DefaultRunSize = 1 << 16
+
+// mergeFanIn - сколько кусков сливается за раз. Если кусков больше,
+// слияние идёт в несколько проходов, так что одновременно открыто не
+// больше mergeFanIn временных файлов.
+const mergeFanIn = 64
+
+// CombineResultsTo работает как CombineResults, но не собирает результат
+// в одну строку: хеши сортируются внешней сортировкой слиянием (куски по
+// runSize элементов сбрасываются во временные файлы в dir) и пишутся в w
+// через _ по мере слияния. В out ничего не отправляется.
+// Пустой dir означает os.TempDir(), runSize <= 0 - DefaultRunSize.
+//
+// Вторым значением возвращается функция, которая после завершения
+// конвейера отдаёт ошибку ввода-вывода, если она была. После ошибки
+// оставшиеся хеши вычитываются из in и отбрасываются.
+func CombineResultsTo(w io.Writer, dir string, runSize int) (job, func() error) {
+	return defaultSigner.CombineResultsTo(w, dir, runSize)
+}
+
+// CombineResultsTo - то же, что пакетный CombineResultsTo, но плохие
+// элементы уходят в s.DeadLetters.
+func (s *Signer) CombineResultsTo(w io.Writer, dir string, runSize int) (job, func() error) {
+	var err error
+	j := func(in, out chan interface{}) {
+		sorter := newExternalSorter(dir, runSize)
+		defer sorter.cleanup()
+		for hash := range in {
+			hashStr, ok := hash.(string)
+			if !ok {
+				s.putDeadLetter("CombineResults", hash, fmt.Errorf("could not convert to string: %#v", hash))
+				continue
+			}
+			if err == nil {
+				err = sorter.add(hashStr)
+			}
+		}
+		if err == nil {
+			err = sorter.writeTo(w, "_")
+		}
+	}
+	return j, func() error { return err }
+}
+
+type externalSorter struct {
+	dir     string
+	runSize int
+	fanIn   int
+	buf     []string
+	// runs - имена временных файлов с отсортированными кусками
+	runs []string
+}
+
+func newExternalSorter(dir string, runSize int) *externalSorter {
+	if runSize <= 0 {
+		runSize = DefaultRunSize
+	}
+	return &externalSorter{dir: dir, runSize: runSize, fanIn: mergeFanIn}
+}
+
+func (s *externalSorter) add(str string) error {
+	s.buf = append(s.buf, str)
+	if len(s.buf) < s.runSize {
+		return nil
+	}
+	return s.spill()
+}
+
+// spill сортирует буфер и сохраняет его во временный файл.
+func (s *externalSorter) spill() error {
+	sort.Strings(s.buf)
+	i := 0
+	err := s.writeRun(func() (string, bool, error) {
+		if i == len(s.buf) {
+			return "", false, nil
+		}
+		i++
+		return s.buf[i-1], true, nil
+	})
+	s.buf = s.buf[:0]
+	return err
+}
+
+// writeRun создаёт новый кусок из строк, которые отдаёт next, в формате
+// <uvarint длина><байты строки>. Файл закрывается сразу после записи.
+func (s *externalSorter) writeRun(next func() (string, bool, error)) error {
+	file, err := ioutil.TempFile(s.dir, "signer-run-")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file.Name())
+
+	w := bufio.NewWriter(file)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for {
+		str, ok, err := next()
+		if err != nil || !ok {
+			if err == nil {
+				err = w.Flush()
+			}
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		n := binary.PutUvarint(lenBuf, uint64(len(str)))
+		w.Write(lenBuf[:n])
+		w.WriteString(str)
+	}
+}
+
+// writeTo сливает все куски и пишет их в w через sep.
+func (s *externalSorter) writeTo(w io.Writer, sep string) error {
+	if len(s.runs) == 0 {
+		sort.Strings(s.buf)
+		return writeJoined(w, s.buf, sep)
+	}
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	// промежуточные проходы: каждые fanIn кусков сливаются в один
+	for len(s.runs) > s.fanIn {
+		runs := s.runs
+		s.runs = nil
+		for len(runs) > 0 {
+			n := s.fanIn
+			if n > len(runs) {
+				n = len(runs)
+			}
+			batch := runs[:n]
+			runs = runs[n:]
+			err := mergeRuns(batch, func(next func() (string, bool, error)) error {
+				return s.writeRun(next)
+			})
+			removeRuns(batch)
+			if err != nil {
+				removeRuns(runs)
+				return err
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	err := mergeRuns(s.runs, func(next func() (string, bool, error)) error {
+		for first := true; ; first = false {
+			str, ok, err := next()
+			if err != nil || !ok {
+				return err
+			}
+			if !first {
+				bw.WriteString(sep)
+			}
+			bw.WriteString(str)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// mergeRuns открывает куски names и передаёт в consume функцию, которая
+// отдаёт их строки по возрастанию.
+func mergeRuns(names []string, consume func(next func() (string, bool, error)) error) error {
+	h := make(runHeap, 0, len(names))
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r := &runReader{r: bufio.NewReader(file)}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+
+	return consume(func() (string, bool, error) {
+		if len(h) == 0 {
+			return "", false, nil
+		}
+		r := h[0]
+		str := r.cur
+		ok, err := r.next()
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+		return str, true, nil
+	})
+}
+
+func removeRuns(names []string) {
+	for _, name := range names {
+		os.Remove(name)
+	}
+}
+
+func (s *externalSorter) cleanup() {
+	removeRuns(s.runs)
+	s.runs = nil
+}
+
+func writeJoined(w io.Writer, strs []string, sep string) error {
+	bw := bufio.NewWriter(w)
+	for i, str := range strs {
+		if i > 0 {
+			if _, err := bw.WriteString(sep); err != nil {
+				return err
+			}
+		}
+		if _, err := bw.WriteString(str); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+type runReader struct {
+	r   *bufio.Reader
+	cur string
+}
+
+func (r *runReader) next() (bool, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return false, err
+	}
+	r.cur = string(b)
+	return true, nil
+}
+
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].cur < h[j].cur }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCombineResultsTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var input []string
+	for i := 0; i < 1000; i++ {
+		input = append(input, strconv.Itoa(rand.Int()))
+	}
+	input = append(input, input[0], "", "_")
+
+	source := job(func(in, out chan interface{}) {
+		for _, str := range input {
+			out <- str
+		}
+	})
+
+	var expected string
+	ExecutePipeline(source, CombineResults, func(in, out chan interface{}) {
+		expected = (<-in).(string)
+	})
+
+	for _, runSize := range []int{1, 7, 1000, 0} {
+		buf := &bytes.Buffer{}
+		combine, wait := CombineResultsTo(buf, dir, runSize)
+		ExecutePipeline(source, combine)
+		if err := wait(); err != nil {
+			t.Errorf("runSize %d: %v", runSize, err)
+		}
+		if buf.String() != expected {
+			t.Errorf("runSize %d: results not match\nGot: %v\nExpected: %v", runSize, buf.String(), expected)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("temp files left: %d", len(files))
+	}
+}
+
+func TestCombineResultsToEmpty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	combine, wait := CombineResultsTo(buf, "", 2)
+	ExecutePipeline(func(in, out chan interface{}) {}, combine)
+	if err := wait(); err != nil || buf.Len() != 0 {
+		t.Errorf("expected empty output, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestExternalSorterPasses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "combine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var input []string
+	for i := 0; i < 200; i++ {
+		input = append(input, strconv.Itoa(rand.Intn(1000)))
+	}
+	expected := append([]string(nil), input...)
+	sort.Strings(expected)
+
+	// 200 кусков по 1 при слиянии по 3: 67 -> 23 -> 8 -> 3 -> итог
+	sorter := newExternalSorter(dir, 1)
+	sorter.fanIn = 3
+	for _, str := range input {
+		if err := sorter.add(str); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := sorter.writeTo(buf, "_"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != strings.Join(expected, "_") {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", buf.String(), expected)
+	}
+	if len(sorter.runs) != 3 {
+		t.Errorf("expected 3 runs in the last pass, got %d", len(sorter.runs))
+	}
+	sorter.cleanup()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temp files left: %d", len(files))
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestCombineResultsToErrors(t *testing.T) {
+	source := job(func(in, out chan interface{}) {
+		for i := 0; i < 100; i++ {
+			out <- strconv.Itoa(i)
+		}
+	})
+
+	// временной папки нет - ошибка на первом сбросе куска, но in
+	// вычитывается до конца и конвейер не зависает
+	combine, wait := CombineResultsTo(&bytes.Buffer{}, "/nonexistent/signer", 10)
+	ExecutePipeline(source, combine)
+	if err := wait(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	for _, runSize := range []int{10, 1000} {
+		combine, wait = CombineResultsTo(failWriter{}, "", runSize)
+		ExecutePipeline(source, combine)
+		if err := wait(); err == nil || err.Error() != "disk full" {
+			t.Errorf("runSize %d: expected write error, got %v", runSize, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DAG - конвейер в виде графа: выход одного job можно раздать нескольким
+// потребителям (Broadcast или Partition), а несколько потоков слить в один
+// вход (Join). Как и в ExecutePipeline, out каждого узла закрывается, когда
+// его job завершился, а вход узла закрывается, когда закрылись все его источники.
+//
+//	d := NewDAG()
+//	d.Add("source", source)
+//	d.Add("single", SingleHash, "source")
+//	d.Add("multi", MultiHash, "single")
+//	d.Add("combine", CombineResults, "multi")
+//	err := d.Run()
+type DAG struct {
+	nodes map[string]*dagNode
+	order []string
+}
+
+// Router решает, каким потребителям узла отдать элемент.
+// consumers - количество потребителей, результат - их индексы.
+type Router func(data interface{}, consumers int) []int
+
+// Broadcast отдаёт каждый элемент всем потребителям. Используется по умолчанию.
+func Broadcast(data interface{}, consumers int) []int {
+	res := make([]int, consumers)
+	for i := range res {
+		res[i] = i
+	}
+	return res
+}
+
+// Partition отдаёт каждый элемент одному потребителю, выбранному по ключу.
+// Потребители нумеруются в порядке добавления узлов в DAG.
+func Partition(key func(data interface{}) int) Router {
+	return func(data interface{}, consumers int) []int {
+		idx := key(data) % consumers
+		if idx < 0 {
+			idx += consumers
+		}
+		return []int{idx}
+	}
+}
+
+type dagNode struct {
+	name      string
+	job       job
+	inputs    []string
+	router    Router
+	consumers []*dagNode
+}
+
+func NewDAG() *DAG {
+	return &DAG{nodes: make(map[string]*dagNode)}
+}
+
+// Add добавляет узел name, вход которого - объединение выходов inputs.
+// Узел без inputs - источник, его in сразу закрыт.
+func (d *DAG) Add(name string, j job, inputs ...string) *DAG {
+	d.nodes[name] = &dagNode{name: name, job: j, inputs: inputs, router: Broadcast}
+	d.order = append(d.order, name)
+	return d
+}
+
+// Route задаёт, как выход узла name раздаётся потребителям.
+func (d *DAG) Route(name string, r Router) *DAG {
+	if node, ok := d.nodes[name]; ok {
+		node.router = r
+	}
+	return d
+}
+
+// Validate проверяет, что у графа уникальные имена, все входы
+// ссылаются на существующие узлы и нет циклов.
+func (d *DAG) Validate() error {
+	if len(d.nodes) != len(d.order) {
+		return fmt.Errorf("dag: duplicate node names")
+	}
+	if len(d.order) == 0 {
+		return fmt.Errorf("dag: no nodes")
+	}
+	for _, name := range d.order {
+		for _, input := range d.nodes[name].inputs {
+			if _, ok := d.nodes[input]; !ok {
+				return fmt.Errorf("dag: node %s: unknown input %s", name, input)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dag: cycle %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, input := range d.nodes[name].inputs {
+			if err := visit(input, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	names := append([]string(nil), d.order...)
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run проверяет граф и выполняет его, дожидаясь завершения всех узлов.
+func (d *DAG) Run() error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	for _, node := range d.nodes {
+		node.consumers = nil
+	}
+	for _, name := range d.order {
+		node := d.nodes[name]
+		for _, input := range node.inputs {
+			src := d.nodes[input]
+			src.consumers = append(src.consumers, node)
+		}
+	}
+
+	ins := make(map[string]chan interface{})
+	producers := make(map[string]*sync.WaitGroup)
+	for _, name := range d.order {
+		node := d.nodes[name]
+		ins[name] = make(chan interface{})
+		producers[name] = &sync.WaitGroup{}
+		producers[name].Add(len(node.inputs))
+	}
+	for _, name := range d.order {
+		in, wg := ins[name], producers[name]
+		go func() {
+			wg.Wait()
+			close(in)
+		}()
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, name := range d.order {
+		node := d.nodes[name]
+		out := make(chan interface{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			node.job(ins[node.name], out)
+			close(out)
+		}()
+		go func() {
+			defer wg.Done()
+			d.dispatch(node, out, ins, producers)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// dispatch раздаёт выход узла потребителям. Если потребителей нет,
+// выход просто вычитывается, чтобы job не заблокировался.
+func (d *DAG) dispatch(node *dagNode, out chan interface{}, ins map[string]chan interface{}, producers map[string]*sync.WaitGroup) {
+	for data := range out {
+		if len(node.consumers) == 0 {
+			continue
+		}
+		for _, idx := range node.router(data, len(node.consumers)) {
+			ins[node.consumers[idx].name] <- data
+		}
+	}
+	for _, consumer := range node.consumers {
+		producers[consumer.name].Done()
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func intSource(vals ...int) job {
+	return func(in, out chan interface{}) {
+		for _, val := range vals {
+			out <- val
+		}
+	}
+}
+
+func multiplyBy(k int) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(int) * k
+		}
+	}
+}
+
+func TestDAGBroadcastJoin(t *testing.T) {
+	var sum, count int64
+	err := NewDAG().
+		Add("source", intSource(1, 2, 3)).
+		Add("double", multiplyBy(2), "source").
+		Add("triple", multiplyBy(3), "source").
+		Add("join", func(in, out chan interface{}) {
+			for val := range in {
+				atomic.AddInt64(&sum, int64(val.(int)))
+				atomic.AddInt64(&count, 1)
+			}
+		}, "double", "triple").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != (1+2+3)*5 || count != 6 {
+		t.Errorf("unexpected join result: sum %d, count %d", sum, count)
+	}
+}
+
+func TestDAGPartition(t *testing.T) {
+	var evens, odds []int
+	collect := func(dst *[]int) job {
+		return func(in, out chan interface{}) {
+			for val := range in {
+				*dst = append(*dst, val.(int))
+			}
+		}
+	}
+	err := NewDAG().
+		Add("source", intSource(0, 1, 2, 3, 4, 5)).
+		Route("source", Partition(func(data interface{}) int { return data.(int) })).
+		Add("evens", collect(&evens), "source").
+		Add("odds", collect(&odds), "source").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evens) != 3 || len(odds) != 3 {
+		t.Fatalf("unexpected partition: %v %v", evens, odds)
+	}
+	for i := range evens {
+		if evens[i]%2 != 0 || odds[i]%2 != 1 {
+			t.Errorf("unexpected partition: %v %v", evens, odds)
+		}
+	}
+}
+
+func TestDAGValidate(t *testing.T) {
+	noop := job(func(in, out chan interface{}) {})
+	cases := []struct {
+		dag *DAG
+		err string
+	}{
+		{NewDAG(), "no nodes"},
+		{NewDAG().Add("a", noop, "missing"), "unknown input missing"},
+		{NewDAG().Add("a", noop, "c").Add("b", noop, "a").Add("c", noop, "b"), "cycle"},
+		{NewDAG().Add("a", noop).Add("a", noop), "duplicate"},
+	}
+	for _, c := range cases {
+		err := c.dag.Run()
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected error containing %q, got %v", c.err, err)
+		}
+	}
+}
+
+func TestDAGSigner(t *testing.T) {
+	testExpected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	testResult := "NOT_SET"
+	err := NewDAG().
+		Add("source", intSource(0, 1)).
+		Add("single", SingleHash, "source").
+		Add("multi", MultiHash, "single").
+		Add("combine", CombineResults, "multi").
+		Add("result", func(in, out chan interface{}) {
+			testResult = (<-in).(string)
+		}, "combine").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+}
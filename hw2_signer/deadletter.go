@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeadLetter - элемент, который стадия не смогла обработать.
+type DeadLetter struct {
+	Stage string
+	Value interface{}
+	Err   error
+}
+
+func (d DeadLetter) String() string {
+	return fmt.Sprintf("%s: %v (value %#v)", d.Stage, d.Err, d.Value)
+}
+
+// DeadLetterSink получает плохие элементы вместо паники,
+// остальные элементы при этом идут по конвейеру дальше.
+// Стадии берут его из Signer.DeadLetters.
+type DeadLetterSink interface {
+	Put(d DeadLetter)
+}
+
+// logDeadLetters пишет плохие элементы в лог, если у Signer не задан
+// свой DeadLetters.
+type logDeadLetters struct{}
+
+func (logDeadLetters) Put(d DeadLetter) {
+	log.Printf("dead letter: %s", d)
+}
+
+// putDeadLetter отправляет элемент в sink, а если он nil - в лог.
+func putDeadLetter(sink DeadLetterSink, stage string, value interface{}, err error) {
+	if sink == nil {
+		sink = logDeadLetters{}
+	}
+	sink.Put(DeadLetter{Stage: stage, Value: value, Err: err})
+}
+
+// DeadLetterQueue собирает плохие элементы в памяти, чтобы в конце
+// запуска посмотреть на них или вывести Report.
+type DeadLetterQueue struct {
+	mu    sync.Mutex
+	items []DeadLetter
+}
+
+func (q *DeadLetterQueue) Put(d DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, d)
+}
+
+// Items возвращает копию собранных элементов.
+func (q *DeadLetterQueue) Items() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.items...)
+}
+
+func (q *DeadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Report - сводка по ошибкам: сколько всего, сколько на каждой стадии
+// и список самих элементов.
+func (q *DeadLetterQueue) Report() string {
+	items := q.Items()
+	if len(items) == 0 {
+		return "dead letters: 0\n"
+	}
+
+	byStage := make(map[string]int)
+	for _, d := range items {
+		byStage[d.Stage]++
+	}
+	stages := make([]string, 0, len(byStage))
+	for stage := range byStage {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+
+	res := strings.Builder{}
+	fmt.Fprintf(&res, "dead letters: %d\n", len(items))
+	for _, stage := range stages {
+		fmt.Fprintf(&res, "  %s: %d\n", stage, byStage[stage])
+	}
+	for _, d := range items {
+		fmt.Fprintf(&res, "  - %s\n", d)
+	}
+	return res.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeadLetters(t *testing.T) {
+	queue := &DeadLetterQueue{}
+	signer := &Signer{Md5: defaultSigner.Md5, Crc32: defaultSigner.Crc32, DeadLetters: queue}
+
+	testExpected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	testResult := "NOT_SET"
+
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			out <- 0
+			out <- "not an int"
+			out <- 1
+		},
+		signer.SingleHash,
+		func(in, out chan interface{}) {
+			out <- 42
+			for val := range in {
+				out <- val
+			}
+		},
+		signer.MultiHash,
+		func(in, out chan interface{}) {
+			out <- 3.14
+			for val := range in {
+				out <- val
+			}
+		},
+		signer.CombineResults,
+		func(in, out chan interface{}) {
+			testResult = (<-in).(string)
+		},
+	)
+
+	if testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+
+	expected := map[string]interface{}{
+		"SingleHash":     "not an int",
+		"MultiHash":      42,
+		"CombineResults": 3.14,
+	}
+	items := queue.Items()
+	if len(items) != len(expected) {
+		t.Fatalf("expected %d dead letters, got %d:\n%s", len(expected), len(items), queue.Report())
+	}
+	for _, d := range items {
+		if expected[d.Stage] != d.Value || d.Err == nil {
+			t.Errorf("unexpected dead letter %s", d)
+		}
+	}
+
+	// CombineResultsTo отправляет плохие элементы туда же
+	combine, wait := signer.CombineResultsTo(&strings.Builder{}, "", 0)
+	ExecutePipeline(func(in, out chan interface{}) {
+		out <- "a"
+		out <- 7
+	}, combine)
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+	if items := queue.Items(); len(items) != 4 || items[3].Stage != "CombineResults" || items[3].Value != 7 {
+		t.Errorf("CombineResultsTo dead letter not sent to signer sink:\n%s", queue.Report())
+	}
+
+	report := queue.Report()
+	if !strings.HasPrefix(report, "dead letters: 4\n") || !strings.Contains(report, "  MultiHash: 1\n") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
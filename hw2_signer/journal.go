@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Журнал для возобновляемых запусков конвейера.
+//
+// Для каждой поэлементной стадии, обёрнутой через Journal.Stage, в файл
+// пишется запись "стадия, вход -> выходы". При повторном запуске с тем же
+// журналом стадия не пересчитывает входы, для которых запись уже есть,
+// а сразу отдаёт сохранённые выходы дальше.
+//
+// Формат файла - последовательность записей
+// <uvarint длина><crc32 4 байта><gob journalRecord>.
+// Недописанный хвост (процесс упал посреди записи) при открытии отрезается.
+// Повреждённая запись в середине тоже отрезается вместе со всем, что после
+// неё: где начинается следующая запись, уже не узнать. Сколько байт так
+// потеряно, сообщает Dropped.
+
+type journalRecord struct {
+	Stage   string
+	Key     string
+	Outputs []interface{}
+}
+
+// DefaultJournalSyncEvery и DefaultJournalSyncInterval задают, как часто
+// журнал делает fsync, если в OpenJournal переданы нули.
+const (
+	DefaultJournalSyncEvery    = 64
+	DefaultJournalSyncInterval = 100 * time.Millisecond
+)
+
+// maxJournalRecord - больше записи не бывает, длина больше - повреждение.
+const maxJournalRecord = 16 << 20
+
+var errJournalClosed = errors.New("journal closed")
+
+type Journal struct {
+	// DeadLetters получает элементы, которые Stage не смог посчитать или
+	// записать в журнал, по умолчанию (nil) - лог. В журнал такие элементы
+	// не попадают, и следующий запуск посчитает их заново.
+	DeadLetters DeadLetterSink
+
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	done    map[string][]interface{}
+	pending int
+	err     error
+	closed  bool
+	dropped int64
+
+	syncEvery int
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// OpenJournal открывает (или создаёт) журнал по пути path и читает из него
+// уже завершённую работу. fsync делается после каждых syncEvery записей
+// и не реже, чем раз в syncInterval.
+func OpenJournal(path string, syncEvery int, syncInterval time.Duration) (*Journal, error) {
+	if syncEvery <= 0 {
+		syncEvery = DefaultJournalSyncEvery
+	}
+	if syncInterval <= 0 {
+		syncInterval = DefaultJournalSyncInterval
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		file:      file,
+		done:      make(map[string][]interface{}),
+		syncEvery: syncEvery,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	size, err := j.recover()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > size {
+		j.dropped = info.Size() - size
+		log.Printf("journal %s: dropped %d bytes of incomplete or corrupted records", path, j.dropped)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	j.w = bufio.NewWriter(file)
+
+	go j.syncLoop(syncInterval)
+	return j, nil
+}
+
+// recover читает записи и возвращает размер корректной части файла.
+func (j *Journal) recover() (int64, error) {
+	r := bufio.NewReader(j.file)
+	var offset int64
+	for {
+		rec, n, err := readJournalRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || err == errJournalCorrupted {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		j.done[journalKey(rec.Stage, rec.Key)] = rec.Outputs
+		offset += n
+	}
+}
+
+var errJournalCorrupted = errors.New("journal record corrupted")
+
+func readJournalRecord(r *bufio.Reader) (journalRecord, int64, error) {
+	rec := journalRecord{}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return rec, 0, err
+	}
+	if size > maxJournalRecord {
+		return rec, 0, errJournalCorrupted
+	}
+	buf := make([]byte, 4+size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return rec, 0, err
+	}
+	payload := buf[4:]
+	if binary.LittleEndian.Uint32(buf[:4]) != crc32.ChecksumIEEE(payload) {
+		return rec, 0, errJournalCorrupted
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, 0, errJournalCorrupted
+	}
+	return rec, int64(uvarintLen(size)) + int64(len(buf)), nil
+}
+
+// Dropped - сколько байт с конца файла отрезано при открытии.
+func (j *Journal) Dropped() int64 {
+	return j.dropped
+}
+
+func uvarintLen(x uint64) int {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return binary.PutUvarint(buf, x)
+}
+
+func journalKey(stage, key string) string {
+	return stage + "\x00" + key
+}
+
+// itemKey - ключ входного элемента в журнале.
+func itemKey(data interface{}) string {
+	return fmt.Sprintf("%T:%#v", data, data)
+}
+
+func (j *Journal) lookup(stage string, data interface{}) ([]interface{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	outputs, ok := j.done[journalKey(stage, itemKey(data))]
+	return outputs, ok
+}
+
+func (j *Journal) append(stage string, data interface{}, outputs []interface{}) error {
+	rec := journalRecord{Stage: stage, Key: itemKey(data), Outputs: outputs}
+	payload := &bytes.Buffer{}
+	if err := gob.NewEncoder(payload).Encode(rec); err != nil {
+		return err
+	}
+	header := make([]byte, binary.MaxVarintLen64+4)
+	n := binary.PutUvarint(header, uint64(payload.Len()))
+	binary.LittleEndian.PutUint32(header[n:], crc32.ChecksumIEEE(payload.Bytes()))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return errJournalClosed
+	}
+	if j.err != nil {
+		return j.err
+	}
+	if _, err := j.w.Write(header[:n+4]); err != nil {
+		j.err = err
+		return err
+	}
+	if _, err := j.w.Write(payload.Bytes()); err != nil {
+		j.err = err
+		return err
+	}
+	j.done[journalKey(rec.Stage, rec.Key)] = outputs
+	j.pending++
+	if j.pending >= j.syncEvery {
+		return j.syncLocked()
+	}
+	return nil
+}
+
+func (j *Journal) syncLocked() error {
+	if j.pending == 0 || j.err != nil {
+		return j.err
+	}
+	if err := j.w.Flush(); err != nil {
+		j.err = err
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		j.err = err
+		return err
+	}
+	j.pending = 0
+	return nil
+}
+
+func (j *Journal) syncLoop(interval time.Duration) {
+	defer close(j.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.mu.Lock()
+			j.syncLocked()
+			j.mu.Unlock()
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// Sync сбрасывает на диск все записанные записи.
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.syncLocked()
+}
+
+// Close сбрасывает журнал на диск и закрывает файл.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	err := j.syncLocked()
+	j.mu.Unlock()
+
+	close(j.stop)
+	<-j.stopped
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Stage оборачивает поэлементную стадию (SingleHash, MultiHash) так, что
+// уже посчитанные в прошлых запусках элементы берутся из журнала.
+// name должен быть уникальным в пределах конвейера и не меняться между запусками.
+func (j *Journal) Stage(name string, jb job) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		for data := range in {
+			data := data
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				outputs, ok := j.lookup(name, data)
+				if !ok {
+					var err error
+					if outputs, err = runItem(jb, data); err == nil {
+						err = j.append(name, data, outputs)
+					}
+					if err != nil {
+						putDeadLetter(j.DeadLetters, name, data, err)
+						return
+					}
+				}
+				for _, val := range outputs {
+					out <- val
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
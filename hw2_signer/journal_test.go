@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	journalHelperEnv = "SIGNER_JOURNAL_HELPER"
+	journalItems     = 200
+)
+
+func journalPipeline(j *Journal, counter *uint32, delay time.Duration) int {
+	sum := 0
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			for i := 0; i < journalItems; i++ {
+				out <- i
+				time.Sleep(delay)
+			}
+		},
+		j.Stage("triple", func(in, out chan interface{}) {
+			for val := range in {
+				atomic.AddUint32(counter, 1)
+				out <- val.(int) * 3
+			}
+		}),
+		func(in, out chan interface{}) {
+			for val := range in {
+				sum += val.(int)
+			}
+		},
+	)
+	return sum
+}
+
+// TestJournalHelperProcess - не настоящий тест, а конвейер, который
+// TestJournalRecovery запускает отдельным процессом и убивает посреди работы.
+func TestJournalHelperProcess(t *testing.T) {
+	path := os.Getenv(journalHelperEnv)
+	if path == "" {
+		return
+	}
+	j, err := OpenJournal(path, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter uint32
+	journalPipeline(j, &counter, 10*time.Millisecond)
+	j.Close()
+}
+
+func TestJournalRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestJournalHelperProcess$")
+	cmd.Env = append(os.Environ(), journalHelperEnv+"="+path)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 1000 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			t.Fatal("journal helper process wrote nothing in 10s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	// имитируем недописанную запись
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{50, 1, 2, 3})
+	file.Close()
+
+	j, err := OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := len(j.done)
+	if completed == 0 || completed >= journalItems {
+		t.Fatalf("expected partially completed journal, got %d records", completed)
+	}
+	if j.Dropped() < 4 {
+		t.Errorf("expected at least 4 dropped bytes, got %d", j.Dropped())
+	}
+
+	var counter uint32
+	sum := journalPipeline(j, &counter, 0)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := 3 * journalItems * (journalItems - 1) / 2; sum != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", sum, expected)
+	}
+	if int(counter) != journalItems-completed {
+		t.Errorf("recomputed %d items, expected %d", counter, journalItems-completed)
+	}
+
+	// третий запуск ничего не пересчитывает
+	j, err = OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	counter = 0
+	journalPipeline(j, &counter, 0)
+	if counter != 0 {
+		t.Errorf("recomputed %d items after full run", counter)
+	}
+}
+
+func TestJournalCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+
+	j, err := OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := j.append("stage", i, []interface{}{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := len(data) / 3
+
+	// длина записи на диске огромная - не пытаемся выделить под неё память
+	huge := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(huge, 1<<62)
+	corrupted := append(append([]byte(nil), data[:recordSize]...), huge[:n]...)
+	corrupted = append(corrupted, data[recordSize:]...)
+	if err := ioutil.WriteFile(path, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if len(j.done) != 1 {
+		t.Errorf("expected 1 record before corruption, got %d", len(j.done))
+	}
+	if expected := int64(len(corrupted) - recordSize); j.Dropped() != expected {
+		t.Errorf("dropped %d bytes, expected %d", j.Dropped(), expected)
+	}
+}
+
+func TestJournalStageErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+
+	run := func(j *Journal, fail bool) (calls uint32, results int) {
+		ExecutePipeline(
+			func(in, out chan interface{}) {
+				for i := 0; i < 3; i++ {
+					out <- i
+				}
+			},
+			j.Stage("triple", func(in, out chan interface{}) {
+				for val := range in {
+					atomic.AddUint32(&calls, 1)
+					if fail && val.(int) == 1 {
+						panic("boom")
+					}
+					out <- val.(int) * 3
+				}
+			}),
+			func(in, out chan interface{}) {
+				for range in {
+					results++
+				}
+			},
+		)
+		return calls, results
+	}
+
+	j, err := OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := &DeadLetterQueue{}
+	j.DeadLetters = queue
+	if _, results := run(j, true); results != 2 || queue.Len() != 1 || queue.Items()[0].Value != 1 {
+		t.Errorf("expected 2 results and 1 dead letter, got %d:\n%s", results, queue.Report())
+	}
+	j.Close()
+
+	// упавший элемент не записан - следующий запуск считает только его
+	j, err = OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls, results := run(j, false); calls != 1 || results != 3 {
+		t.Errorf("expected 1 call and 3 results, got %d and %d", calls, results)
+	}
+
+	// журнал не пишется - элементы уходят в DeadLetters, а не роняют процесс
+	j.Close()
+	os.Remove(path)
+	j, err = OpenJournal(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	queue = &DeadLetterQueue{}
+	j.DeadLetters = queue
+	if _, results := run(j, false); results != 0 || queue.Len() != 3 {
+		t.Errorf("expected 3 dead letters, got %d results:\n%s", results, queue.Report())
+	}
+}
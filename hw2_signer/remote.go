@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Воркер и прокси для выполнения стадий конвейера на других процессах.
+// Протокол - поток gob-сообщений в обе стороны по одному TCP-соединению:
+// клиент шлёт remoteRequest на каждый элемент, воркер отвечает remoteResponse
+// с тем же ID. Ответы могут приходить в любом порядке.
+//
+// Удалённо можно выполнять только поэлементные стадии (SingleHash, MultiHash):
+// воркер запускает job отдельно для каждого элемента, поэтому стадии,
+// которым нужен весь поток целиком (CombineResults), так не работают.
+
+type remoteRequest struct {
+	ID    uint64
+	Job   string
+	Value interface{}
+}
+
+type remoteResponse struct {
+	ID     uint64
+	Values []interface{}
+	Err    string
+}
+
+var errWorkerClosed = errors.New("worker connection closed")
+
+// Worker выполняет зарегистрированные job по запросам RemoteStage.
+type Worker struct {
+	mu    sync.Mutex
+	jobs  map[string]job
+	ls    []net.Listener
+	conns map[net.Conn]bool
+}
+
+func NewWorker() *Worker {
+	return &Worker{
+		jobs:  make(map[string]job),
+		conns: make(map[net.Conn]bool),
+	}
+}
+
+// Register делает job доступным удалённо под именем name.
+func (w *Worker) Register(name string, j job) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.jobs[name] = j
+}
+
+// Serve принимает соединения на l, пока не будет вызван Close.
+func (w *Worker) Serve(l net.Listener) error {
+	w.mu.Lock()
+	w.ls = append(w.ls, l)
+	w.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.conns[conn] = true
+		w.mu.Unlock()
+		go w.serveConn(conn)
+	}
+}
+
+// Close закрывает все слушающие сокеты и открытые соединения.
+func (w *Worker) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, l := range w.ls {
+		l.Close()
+	}
+	for conn := range w.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (w *Worker) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		w.mu.Lock()
+		delete(w.conns, conn)
+		w.mu.Unlock()
+	}()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	encMu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		req := remoteRequest{}
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := w.handle(req)
+			encMu.Lock()
+			defer encMu.Unlock()
+			if err := enc.Encode(resp); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+func (w *Worker) handle(req remoteRequest) remoteResponse {
+	w.mu.Lock()
+	j, ok := w.jobs[req.Job]
+	w.mu.Unlock()
+	if !ok {
+		return remoteResponse{ID: req.ID, Err: fmt.Sprintf("unknown job %q", req.Job)}
+	}
+
+	values, err := runItem(j, req.Value)
+	if err != nil {
+		return remoteResponse{ID: req.ID, Err: err.Error()}
+	}
+	return remoteResponse{ID: req.ID, Values: values}
+}
+
+// runItem прогоняет через j один элемент и собирает всё, что он вернул.
+// Паника внутри j превращается в ошибку.
+func runItem(j job, data interface{}) (values []interface{}, err error) {
+	in := make(chan interface{}, 1)
+	out := make(chan interface{})
+	in <- data
+	close(in)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for val := range out {
+			values = append(values, val)
+		}
+	}()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		defer close(out)
+		j(in, out)
+	}()
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// RemoteStage - job, который отправляет элементы из in на воркеры по сети
+// и пишет в out то, что они вернули.
+type RemoteStage struct {
+	// Job - имя, под которым job зарегистрирован на воркерах.
+	Job   string
+	Addrs []string
+
+	// MaxInFlight ограничивает число необработанных запросов на одного воркера.
+	// 0 - без ограничений.
+	MaxInFlight int
+	// Retries - сколько раз элемент переотправляется на другой воркер,
+	// если текущий отвалился.
+	Retries     int
+	DialTimeout time.Duration
+	// CallTimeout - сколько ждать ответа на один элемент, по умолчанию
+	// defaultCallTimeout. Не ответивший вовремя воркер считается мёртвым.
+	CallTimeout time.Duration
+	// DeadLetters - куда отправлять элементы, которые не удалось обработать,
+	// по умолчанию (nil) - в лог.
+	DeadLetters DeadLetterSink
+}
+
+const (
+	defaultDialTimeout = 5 * time.Second
+	defaultCallTimeout = time.Minute
+)
+
+// Run подходит для передачи в ExecutePipeline: job(stage.Run).
+// Элементы, которые не удалось обработать ни на одном воркере, и все
+// элементы, если не удалось подключиться ни к одному, уходят в
+// s.DeadLetters, остальные идут дальше.
+func (s *RemoteStage) Run(in, out chan interface{}) {
+	pool, err := s.dial()
+	if err != nil {
+		for data := range in {
+			putDeadLetter(s.DeadLetters, s.Job, data, err)
+		}
+		return
+	}
+	defer pool.close()
+
+	wg := &sync.WaitGroup{}
+	for data := range in {
+		data := data
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := pool.call(s.Job, data, s.Retries)
+			if err != nil {
+				putDeadLetter(s.DeadLetters, s.Job, data, err)
+				return
+			}
+			for _, val := range values {
+				out <- val
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *RemoteStage) dial() (*workerPool, error) {
+	timeout, callTimeout := s.DialTimeout, s.CallTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+	if callTimeout == 0 {
+		callTimeout = defaultCallTimeout
+	}
+	pool := &workerPool{}
+	pool.cond = sync.NewCond(&pool.mu)
+	var lastErr error
+	for _, addr := range s.Addrs {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		pool.workers = append(pool.workers, newWorkerConn(conn, pool, s.MaxInFlight, callTimeout))
+	}
+	if len(pool.workers) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no worker addresses")
+		}
+		return nil, fmt.Errorf("remote stage %s: %v", s.Job, lastErr)
+	}
+	return pool, nil
+}
+
+// workerPool раздаёт запросы наименее загруженному живому воркеру.
+type workerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	workers []*workerConn
+}
+
+func (p *workerPool) call(jobName string, data interface{}, retries int) ([]interface{}, error) {
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		w, err := p.acquire()
+		if err != nil {
+			return nil, err
+		}
+		values, err := w.call(jobName, data)
+		p.release(w)
+		if err == nil {
+			return values, nil
+		}
+		if _, ok := err.(remoteJobError); ok {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("remote stage %s: %v failed after %d attempts: %v", jobName, data, retries+1, lastErr)
+}
+
+func (p *workerPool) acquire() (*workerConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		var best *workerConn
+		alive := 0
+		for _, w := range p.workers {
+			if w.dead {
+				continue
+			}
+			alive++
+			if w.limit > 0 && w.inFlight >= w.limit {
+				continue
+			}
+			if best == nil || w.inFlight < best.inFlight {
+				best = w
+			}
+		}
+		if alive == 0 {
+			return nil, errors.New("no alive workers")
+		}
+		if best != nil {
+			best.inFlight++
+			return best, nil
+		}
+		p.cond.Wait()
+	}
+}
+
+func (p *workerPool) release(w *workerConn) {
+	p.mu.Lock()
+	w.inFlight--
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// markDead исключает w из раздачи; вызывается до того, как ждущие ответа
+// от w узнают об ошибке, чтобы при повторе они не выбрали его снова.
+func (p *workerPool) markDead(w *workerConn) {
+	p.mu.Lock()
+	w.dead = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *workerPool) close() {
+	for _, w := range p.workers {
+		w.conn.Close()
+	}
+}
+
+type remoteJobError string
+
+func (e remoteJobError) Error() string { return string(e) }
+
+type workerConn struct {
+	conn    net.Conn
+	pool    *workerPool
+	limit   int
+	timeout time.Duration
+
+	// защищены pool.mu
+	inFlight int
+	dead     bool
+
+	encMu sync.Mutex
+	enc   *gob.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan remoteResponse
+	err     error
+}
+
+func newWorkerConn(conn net.Conn, pool *workerPool, limit int, timeout time.Duration) *workerConn {
+	w := &workerConn{
+		conn:    conn,
+		pool:    pool,
+		limit:   limit,
+		timeout: timeout,
+		enc:     gob.NewEncoder(conn),
+		pending: make(map[uint64]chan remoteResponse),
+	}
+	go w.readLoop()
+	return w
+}
+
+func (w *workerConn) call(jobName string, data interface{}) ([]interface{}, error) {
+	resCh := make(chan remoteResponse, 1)
+
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return nil, w.err
+	}
+	w.nextID++
+	id := w.nextID
+	w.pending[id] = resCh
+	w.mu.Unlock()
+
+	w.encMu.Lock()
+	err := w.enc.Encode(remoteRequest{ID: id, Job: jobName, Value: data})
+	w.encMu.Unlock()
+	if err != nil {
+		w.fail(err)
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	var (
+		resp remoteResponse
+		ok   bool
+	)
+	select {
+	case resp, ok = <-resCh:
+	case <-timer.C:
+		// fail закроет resCh, если ответ так и не пришёл
+		w.fail(fmt.Errorf("no response in %v", w.timeout))
+		resp, ok = <-resCh
+	}
+	if !ok {
+		return nil, w.err
+	}
+	if resp.Err != "" {
+		return nil, remoteJobError(resp.Err)
+	}
+	return resp.Values, nil
+}
+
+func (w *workerConn) readLoop() {
+	dec := gob.NewDecoder(w.conn)
+	for {
+		resp := remoteResponse{}
+		if err := dec.Decode(&resp); err != nil {
+			if err == io.EOF {
+				err = errWorkerClosed
+			}
+			w.fail(err)
+			return
+		}
+		w.mu.Lock()
+		resCh, ok := w.pending[resp.ID]
+		delete(w.pending, resp.ID)
+		w.mu.Unlock()
+		if ok {
+			resCh <- resp
+		}
+	}
+}
+
+// fail помечает воркера мёртвым и будит всех, кто ждёт от него ответа.
+func (w *workerConn) fail(err error) {
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.err = fmt.Errorf("worker %s: %v", w.conn.RemoteAddr(), err)
+	w.pool.markDead(w)
+	for id, resCh := range w.pending {
+		close(resCh)
+		delete(w.pending, id)
+	}
+	w.mu.Unlock()
+
+	w.conn.Close()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+)
+
+func startWorker(t *testing.T) (*Worker, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker()
+	w.Register("triple", func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(int) * 3
+		}
+	})
+	w.Register("MultiHash", MultiHash)
+	go w.Serve(l)
+	return w, l.Addr().String()
+}
+
+// startBrokenWorker принимает соединения, читает запрос и сразу закрывает соединение.
+func startBrokenWorker(t *testing.T) (net.Listener, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+	}()
+	return l, l.Addr().String()
+}
+
+// startHungWorker принимает соединения и читает запросы, но не отвечает.
+func startHungWorker(t *testing.T) (net.Listener, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l, l.Addr().String()
+}
+
+func collectInts(t *testing.T, stage *RemoteStage, input []int) []int {
+	var res []int
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			for _, val := range input {
+				out <- val
+			}
+		},
+		stage.Run,
+		func(in, out chan interface{}) {
+			for val := range in {
+				res = append(res, val.(int))
+			}
+		},
+	)
+	sort.Ints(res)
+	return res
+}
+
+func TestRemoteStage(t *testing.T) {
+	w1, addr1 := startWorker(t)
+	defer w1.Close()
+	w2, addr2 := startWorker(t)
+	defer w2.Close()
+
+	var input, expected []int
+	for i := 0; i < 100; i++ {
+		input = append(input, i)
+		expected = append(expected, i*3)
+	}
+
+	stage := &RemoteStage{Job: "triple", Addrs: []string{addr1, addr2}, MaxInFlight: 4}
+	res := collectInts(t, stage, input)
+	if len(res) != len(expected) {
+		t.Fatalf("got %d results, expected %d", len(res), len(expected))
+	}
+	for i := range res {
+		if res[i] != expected[i] {
+			t.Fatalf("results not match\nGot: %v\nExpected: %v", res, expected)
+		}
+	}
+}
+
+func TestRemoteStageRetry(t *testing.T) {
+	broken, brokenAddr := startBrokenWorker(t)
+	defer broken.Close()
+	w, addr := startWorker(t)
+	defer w.Close()
+
+	stage := &RemoteStage{Job: "triple", Addrs: []string{brokenAddr, addr}, Retries: 1}
+	res := collectInts(t, stage, []int{1, 2, 3, 4, 5})
+	if len(res) != 5 || res[0] != 3 || res[4] != 15 {
+		t.Errorf("unexpected results: %v", res)
+	}
+}
+
+func TestRemoteStageAllWorkersDown(t *testing.T) {
+	broken, brokenAddr := startBrokenWorker(t)
+	defer broken.Close()
+
+	queue := &DeadLetterQueue{}
+	stage := &RemoteStage{Job: "triple", Addrs: []string{brokenAddr}, Retries: 2, DeadLetters: queue}
+	stage.Run(makeClosedChan(1, 2), make(chan interface{}, 2))
+	if queue.Len() != 2 {
+		t.Errorf("expected 2 dead letters, got:\n%s", queue.Report())
+	}
+
+	// ни одного воркера - все элементы в DeadLetters, конвейер не падает
+	broken.Close()
+	queue = &DeadLetterQueue{}
+	stage = &RemoteStage{Job: "triple", Addrs: []string{brokenAddr}, DeadLetters: queue}
+	if res := collectInts(t, stage, []int{1, 2, 3}); len(res) != 0 || queue.Len() != 3 {
+		t.Errorf("unexpected results %v, dead letters:\n%s", res, queue.Report())
+	}
+}
+
+func TestRemoteStageHungWorker(t *testing.T) {
+	hung, hungAddr := startHungWorker(t)
+	defer hung.Close()
+	w, addr := startWorker(t)
+	defer w.Close()
+
+	queue := &DeadLetterQueue{}
+	stage := &RemoteStage{Job: "triple", Addrs: []string{hungAddr, addr}, Retries: 1,
+		CallTimeout: 100 * time.Millisecond, DeadLetters: queue}
+	res := collectInts(t, stage, []int{1, 2, 3, 4, 5})
+	if len(res) != 5 || res[0] != 3 || res[4] != 15 || queue.Len() != 0 {
+		t.Errorf("unexpected results %v, dead letters:\n%s", res, queue.Report())
+	}
+
+	// без повторов элементы, попавшие на зависший воркер, уходят в DeadLetters
+	queue = &DeadLetterQueue{}
+	stage = &RemoteStage{Job: "triple", Addrs: []string{hungAddr}, CallTimeout: 50 * time.Millisecond, DeadLetters: queue}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		collectInts(t, stage, []int{1, 2})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RemoteStage blocked on hung worker")
+	}
+	if queue.Len() != 2 {
+		t.Errorf("expected 2 dead letters, got:\n%s", queue.Report())
+	}
+}
+
+func TestRemoteMultiHash(t *testing.T) {
+	w, addr := startWorker(t)
+	defer w.Close()
+
+	stage := &RemoteStage{Job: "MultiHash", Addrs: []string{addr}}
+	var res string
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			out <- "4108050209~502633748"
+		},
+		stage.Run,
+		func(in, out chan interface{}) {
+			res = (<-in).(string)
+		},
+	)
+	expected := "29568666068035183841425683795340791879727309630931025356555"
+	if res != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+func makeClosedChan(vals ...interface{}) chan interface{} {
+	ch := make(chan interface{}, len(vals))
+	for _, val := range vals {
+		ch <- val
+	}
+	close(ch)
+	return ch
+}
@@ -1,22 +1,102 @@
 package main
 
 import (
+	"crypto/md5"
 	"fmt"
+	"hash/crc32"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type syncMd5Signer sync.Mutex
+// Signer хранит всё, от чего зависят SingleHash и MultiHash: соль, часы,
+// подписывающие функции и куда отправлять плохие элементы. Несколько Signer
+// с разными настройками можно использовать в одном процессе одновременно.
+type Signer struct {
+	Salt  string
+	Clock Clock
 
-func (mx *syncMd5Signer) sign(data string) string {
-	(*sync.Mutex)(mx).Lock()
-	defer (*sync.Mutex)(mx).Unlock()
-	return DataSignerMd5(data)
+	// Md5 и Crc32 по умолчанию (nil) считают хеш с учётом Salt и Clock,
+	// как DataSignerMd5 и DataSignerCrc32, но с собственным флагом перегрева.
+	Md5   func(data string) string
+	Crc32 func(data string) string
+
+	// DeadLetters - куда отправлять плохие элементы, по умолчанию (nil)
+	// они пишутся в лог.
+	DeadLetters DeadLetterSink
+
+	md5Mu    sync.Mutex
+	overheat uint32
+}
+
+func NewSigner(salt string) *Signer {
+	return &Signer{Salt: salt}
+}
+
+// defaultSigner работает через пакетные DataSignerMd5 и DataSignerCrc32,
+// чтобы их по-прежнему можно было подменять в тестах.
+var defaultSigner = &Signer{
+	Md5:   func(data string) string { return DataSignerMd5(data) },
+	Crc32: func(data string) string { return DataSignerCrc32(data) },
+}
+
+func (s *Signer) clock() Clock {
+	if s.Clock == nil {
+		return realClock{}
+	}
+	return s.Clock
+}
+
+func (s *Signer) overheatLock() {
+	for !atomic.CompareAndSwapUint32(&s.overheat, 0, 1) {
+		fmt.Println("OverheatLock happend")
+		s.clock().Sleep(time.Second)
+	}
+}
+
+func (s *Signer) overheatUnlock() {
+	for !atomic.CompareAndSwapUint32(&s.overheat, 1, 0) {
+		fmt.Println("OverheatUnlock happend")
+		s.clock().Sleep(time.Second)
+	}
+}
+
+func (s *Signer) md5(data string) string {
+	if s.Md5 != nil {
+		return s.Md5(data)
+	}
+	s.overheatLock()
+	defer s.overheatUnlock()
+	data += s.Salt
+	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
+	s.clock().Sleep(10 * time.Millisecond)
+	return dataHash
+}
+
+func (s *Signer) crc32(data string) string {
+	if s.Crc32 != nil {
+		return s.Crc32(data)
+	}
+	data += s.Salt
+	crcH := crc32.ChecksumIEEE([]byte(data))
+	dataHash := strconv.FormatUint(uint64(crcH), 10)
+	s.clock().Sleep(time.Second)
+	return dataHash
+}
+
+// syncMd5 не даёт вызывать md5 параллельно, чтобы не было перегрева.
+func (s *Signer) syncMd5(data string) string {
+	s.md5Mu.Lock()
+	defer s.md5Mu.Unlock()
+	return s.md5(data)
 }
 
-var syncMd5 = syncMd5Signer{}
+func (s *Signer) putDeadLetter(stage string, value interface{}, err error) {
+	putDeadLetter(s.DeadLetters, stage, value, err)
+}
 
 func ExecutePipeline(jobs ...job) {
 	var in, out chan interface{}
@@ -41,37 +121,43 @@ func ExecutePipeline(jobs ...job) {
 //( конкатенация двух строк через ~), где data - то что пришло
 // на вход (по сути - числа из первой функции).
 func SingleHash(in, out chan interface{}) {
+	defaultSigner.SingleHash(in, out)
+}
+
+// SingleHash - то же, что пакетный SingleHash, но с настройками s.
+func (s *Signer) SingleHash(in, out chan interface{}) {
 	wg := &sync.WaitGroup{}
 	for data := range in {
 		data := data
 		wg.Add(1)
 		go func() {
-			asyncSingleHash(data, out)
+			s.asyncSingleHash(data, out)
 			wg.Done()
 		}()
 	}
 	wg.Wait()
 }
 
-func asyncSingleHash(data interface{}, out chan<- interface{}) {
+func (s *Signer) asyncSingleHash(data interface{}, out chan<- interface{}) {
 	dataInt, ok := data.(int)
 	if !ok {
-		panic(fmt.Errorf("could not convert to int: %#v", data))
+		s.putDeadLetter("SingleHash", data, fmt.Errorf("could not convert to int: %#v", data))
+		return
 	}
 	dataStr := strconv.Itoa(dataInt)
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
-	hash1 := asyncCrc32(dataStr, wg)
-	hash2 := asyncCrc32(syncMd5.sign(dataStr), wg)
+	hash1 := s.asyncCrc32(dataStr, wg)
+	hash2 := s.asyncCrc32(s.syncMd5(dataStr), wg)
 	wg.Wait()
 	hash := *hash1 + "~" + *hash2
 	out <- hash
 }
 
-func asyncCrc32(data string, wg *sync.WaitGroup) *string {
+func (s *Signer) asyncCrc32(data string, wg *sync.WaitGroup) *string {
 	hash := new(string)
 	go func() {
-		*hash = DataSignerCrc32(data)
+		*hash = s.crc32(data)
 		wg.Done()
 	}()
 	return hash
@@ -83,30 +169,36 @@ func asyncCrc32(data string, wg *sync.WaitGroup) *string {
 // в порядке расчета (0..5), где data - то что пришло на вход
 // (и ушло на выход из SingleHash)
 func MultiHash(in, out chan interface{}) {
+	defaultSigner.MultiHash(in, out)
+}
+
+// MultiHash - то же, что пакетный MultiHash, но с настройками s.
+func (s *Signer) MultiHash(in, out chan interface{}) {
 	wgMultiHash := &sync.WaitGroup{}
 	for data := range in {
 		data := data
 		wgMultiHash.Add(1)
 		go func() {
-			asyncMultiHash(data, out)
+			s.asyncMultiHash(data, out)
 			wgMultiHash.Done()
 		}()
 	}
 	wgMultiHash.Wait()
 }
 
-func asyncMultiHash(data interface{}, out chan<- interface{}) {
+func (s *Signer) asyncMultiHash(data interface{}, out chan<- interface{}) {
 	n := 6
 	dataStr, ok := data.(string)
 	if !ok {
-		panic(fmt.Errorf("could not convert to string: %#v", data))
+		s.putDeadLetter("MultiHash", data, fmt.Errorf("could not convert to string: %#v", data))
+		return
 	}
 	hashes := make([]*string, n)
 	wg := &sync.WaitGroup{}
 	wg.Add(n)
 	for i := range hashes {
 		iStr := strconv.Itoa(i)
-		hashes[i] = asyncCrc32(iStr+dataStr, wg)
+		hashes[i] = s.asyncCrc32(iStr+dataStr, wg)
 	}
 	res := strings.Builder{}
 	wg.Wait()
@@ -120,11 +212,18 @@ func asyncMultiHash(data interface{}, out chan<- interface{}) {
 // (https://golang.org/pkg/sort/), объединяет отсортированный
 // результат через _ (символ подчеркивания) в одну строку
 func CombineResults(in, out chan interface{}) {
+	defaultSigner.CombineResults(in, out)
+}
+
+// CombineResults - то же, что пакетный CombineResults, но плохие
+// элементы уходят в s.DeadLetters.
+func (s *Signer) CombineResults(in, out chan interface{}) {
 	var hashes []string
 	for hash := range in {
 		hashStr, ok := hash.(string)
 		if !ok {
-			panic(fmt.Errorf("could not convert to string: %#v", hash))
+			s.putDeadLetter("CombineResults", hash, fmt.Errorf("could not convert to string: %#v", hash))
+			continue
 		}
 		hashes = append(hashes, hashStr)
 	}
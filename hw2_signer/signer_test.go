@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expectedSign считает ту же цепочку хешей напрямую, без задержек.
+func expectedSign(salt string, input []int) string {
+	crc := func(data string) string {
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+salt))), 10)
+	}
+	var hashes []string
+	for _, val := range input {
+		data := strconv.Itoa(val)
+		single := crc(data) + "~" + crc(fmt.Sprintf("%x", md5.Sum([]byte(data+salt))))
+		multi := ""
+		for th := 0; th < 6; th++ {
+			multi += crc(strconv.Itoa(th) + single)
+		}
+		hashes = append(hashes, multi)
+	}
+	sort.Strings(hashes)
+	return strings.Join(hashes, "_")
+}
+
+func TestSignersWithDifferentSalts(t *testing.T) {
+	input := []int{0, 1, 1, 2, 3, 5, 8}
+	salts := []string{"", "salt", "другая соль"}
+
+	results := make([]string, len(salts))
+	wg := &sync.WaitGroup{}
+	for i, salt := range salts {
+		i, salt := i, salt
+		clock := NewFakeClock(time.Unix(0, 0))
+		signer := &Signer{Salt: salt, Clock: clock, DeadLetters: &DeadLetterQueue{}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runSigner(t, signer, clock, input...)
+		}()
+	}
+	wg.Wait()
+
+	for i, salt := range salts {
+		if expected := expectedSign(salt, input); results[i] != expected {
+			t.Errorf("salt %q: results not match\nGot: %v\nExpected: %v", salt, results[i], expected)
+		}
+	}
+	if results[0] == results[1] {
+		t.Errorf("salt does not affect result")
+	}
+}
@@ -14,7 +14,12 @@ import (
 const filePath string = "./data/users.txt"
 
 func SlowSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+	slowSearchFile(out, filePath)
+}
+
+// slowSearchFile - SlowSearch по файлу path.
+func slowSearchFile(out io.Writer, path string) {
+	file, err := os.Open(path)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"coursera/hw3_bench/jsonl"
+)
+
+// Дедупликация пользователей: один и тот же человек встречается под разными
+// id с по-разному записанным email. Пользователи с одинаковыми
+// нормализованными email и именем сливаются в один: name, email и country
+// берутся у первого, браузеры объединяются. Остальные поля исходного файла
+// (company, phone, ...) переносятся как есть: берутся у первой записи,
+// недостающие - у следующих.
+
+// emailDomainAliases - другие имена того же домена: ящик на них тот же
+// самый. Отдельные сервисы одной компании (hotmail.com и outlook.com)
+// сюда не входят - там разные ящики.
+var emailDomainAliases = map[string]string{
+	"googlemail.com": "gmail.com",
+	"ya.ru":          "yandex.ru",
+	"yandex.com":     "yandex.ru",
+}
+
+// userFields - поля, которые разбираются в user, остальные идут в Extra.
+var userFields = map[string]bool{
+	"name":     true,
+	"email":    true,
+	"country":  true,
+	"browsers": true,
+}
+
+// emailSubaddressDomains поддерживают +метки: user+tag - тот же ящик, что user.
+// На остальных доменах + может быть частью имени ящика.
+var emailSubaddressDomains = map[string]bool{
+	"gmail.com":      true,
+	"yandex.ru":      true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"icloud.com":     true,
+	"fastmail.com":   true,
+	"protonmail.com": true,
+}
+
+// emailDotlessDomains игнорируют точки в имени ящика.
+var emailDotlessDomains = map[string]bool{
+	"gmail.com": true,
+}
+
+// NormalizeEmail приводит email к каноническому виду: обрезает пробелы,
+// переводит в нижний регистр, отбрасывает точку в конце домена, заменяет
+// домены-синонимы, отбрасывает +метку там, где она поддерживается,
+// для gmail убирает точки.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], strings.TrimSuffix(email[at+1:], ".")
+	if alias, ok := emailDomainAliases[domain]; ok {
+		domain = alias
+	}
+	if plus := strings.IndexByte(local, '+'); plus > 0 && emailSubaddressDomains[domain] {
+		local = local[:plus]
+	}
+	if emailDotlessDomains[domain] {
+		local = strings.Replace(local, ".", "", -1)
+	}
+	return local + "@" + domain
+}
+
+// normalizeName сравнивает имена без учёта регистра и лишних пробелов.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// UserCluster - один человек, собранный из нескольких записей.
+type UserCluster struct {
+	// IDs - номера строк исходного файла, первый - тот, что оставлен.
+	IDs []int
+	// Emails - различные исходные email в порядке появления.
+	Emails []string
+	User   user
+	// Extra - остальные поля записи в исходном виде.
+	Extra map[string]json.RawMessage
+}
+
+type DedupResult struct {
+	Users    int
+	Clusters []*UserCluster
+}
+
+// Dedup читает пользователей из in и группирует дубликаты.
+// Кластеры идут в порядке первого появления.
+func Dedup(in *Input) (*DedupResult, error) {
+	res := &DedupResult{}
+	byKey := make(map[string]*UserCluster)
+	seenBrowsers := make(map[*UserCluster]map[string]bool)
+
+	lines := in.Lines()
+	for id := 0; ; id++ {
+		u := new(user)
+		if !lines.Next(u) {
+			break
+		}
+		res.Users++
+
+		email := NormalizeEmail(u.Email)
+		key := email + "\x00" + normalizeName(u.Name)
+		c, ok := byKey[key]
+		if !ok {
+			c = &UserCluster{
+				User:  user{Name: strings.TrimSpace(u.Name), Email: email, Country: u.Country},
+				Extra: make(map[string]json.RawMessage),
+			}
+			byKey[key] = c
+			seenBrowsers[c] = make(map[string]bool)
+			res.Clusters = append(res.Clusters, c)
+		}
+
+		c.IDs = append(c.IDs, id)
+		if !containsString(c.Emails, u.Email) {
+			c.Emails = append(c.Emails, u.Email)
+		}
+		if c.User.Country == "" {
+			c.User.Country = u.Country
+		}
+		if err := addExtraFields(c, lines); err != nil {
+			return nil, err
+		}
+		for _, browser := range u.Browsers {
+			if !seenBrowsers[c][browser] {
+				seenBrowsers[c][browser] = true
+				c.User.Browsers = append(c.User.Browsers, browser)
+			}
+		}
+	}
+	return res, lines.Err()
+}
+
+// addExtraFields дописывает в c.Extra поля текущей строки lines, которых
+// там ещё нет.
+func addExtraFields(c *UserCluster, lines *jsonl.Reader) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(lines.Bytes(), &fields); err != nil {
+		return &jsonl.LineError{Line: lines.Line(), Err: err}
+	}
+	for name, value := range fields {
+		if _, ok := c.Extra[name]; !ok && !userFields[name] {
+			c.Extra[name] = value
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Merged - сколько записей оказались дубликатами.
+func (r *DedupResult) Merged() int {
+	return r.Users - len(r.Clusters)
+}
+
+// WriteUsers пишет по JSON-строке на кластер в формате users.txt: все поля
+// записи, ключи по алфавиту.
+func (r *DedupResult) WriteUsers(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	var b []byte
+	for _, c := range r.Clusters {
+		fields := make(map[string][]byte, len(c.Extra)+len(userFields))
+		for name, value := range c.Extra {
+			fields[name] = value
+		}
+		browsers := []byte{'['}
+		for i, browser := range c.User.Browsers {
+			if i > 0 {
+				browsers = append(browsers, ',')
+			}
+			browsers = appendJSONString(browsers, browser)
+		}
+		fields["browsers"] = append(browsers, ']')
+		fields["country"] = appendJSONString(nil, c.User.Country)
+		fields["email"] = appendJSONString(nil, c.User.Email)
+		fields["name"] = appendJSONString(nil, c.User.Name)
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b = append(b[:0], '{')
+		for i, name := range names {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, name)
+			b = append(b, ':')
+			b = append(b, fields[name]...)
+		}
+		b = append(b, "}\n"...)
+		w.Write(b)
+	}
+	return w.Flush()
+}
+
+// WriteReport выводит итоги и по строке на каждый кластер из нескольких записей:
+//
+//	[id] name <email> <- id, id: исходный email, исходный email
+func (r *DedupResult) WriteReport(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "users %d\nunique %d\nmerged %d\n", r.Users, len(r.Clusters), r.Merged())
+	for _, c := range r.Clusters {
+		if len(c.IDs) < 2 {
+			continue
+		}
+		fmt.Fprintf(w, "\n[%d] %s <%s> <- ", c.IDs[0], c.User.Name, c.User.Email)
+		for i, id := range c.IDs[1:] {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(strconv.Itoa(id))
+		}
+		fmt.Fprintf(w, ": %s", strings.Join(c.Emails, ", "))
+	}
+	if r.Merged() > 0 {
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// DedupUsers дедуплицирует srcPath в dstPath и пишет отчёт в report.
+func DedupUsers(srcPath, dstPath string, report io.Writer) {
+	in, err := OpenInput(srcPath, InputOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer in.Close()
+
+	res, err := Dedup(in)
+	if err != nil {
+		panic(err)
+	}
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		panic(err)
+	}
+	defer dst.Close()
+	if err := res.WriteUsers(dst); err != nil {
+		panic(err)
+	}
+	if err := res.WriteReport(report); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	for email, expected := range map[string]string{
+		"JonathanMorris@Muxo.edu":             "jonathanmorris@muxo.edu",
+		"  jonathanmorris@muxo.edu ":          "jonathanmorris@muxo.edu",
+		"Jonathan.Morris+news@GoogleMail.com": "jonathanmorris@gmail.com",
+		"jonathan.morris@muxo.edu.":           "jonathan.morris@muxo.edu",
+		"jm+x@ya.ru":                          "jm@yandex.ru",
+		"jm@hotmail.com":                      "jm@hotmail.com",
+		"jm+x@outlook.com":                    "jm@outlook.com",
+		"jm+x@muxo.edu":                       "jm+x@muxo.edu",
+		"+jm@muxo.edu":                        "+jm@muxo.edu",
+		"not an email":                        "not an email",
+	} {
+		if got := NormalizeEmail(email); got != expected {
+			t.Errorf("%q: got %q, expected %q", email, got, expected)
+		}
+	}
+}
+
+const dedupInput = `{"browsers":["Android","MSIE"],"company":"Muxo","country":"Kenya","email":"Sharon.Crawford@Gmail.com","name":"Sharon Crawford"}
+{"browsers":["Opera"],"country":"Malta","email":"bob@muxo.edu","name":"Bob"}
+{"browsers":["MSIE","Chrome"],"company":"Shop","email":" sharoncrawford+shop@googlemail.com","name":"sharon  crawford","phone":"1-2-3"}
+{"browsers":["Opera"],"country":"Peru","email":"BOB@muxo.edu","name":"Robert"}
+{"browsers":[],"country":"Malta","email":"bob@Muxo.edu.","name":"BOB"}`
+
+func TestDedup(t *testing.T) {
+	in, _ := NewInput(strings.NewReader(dedupInput))
+	res, err := Dedup(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Users != 5 || len(res.Clusters) != 3 || res.Merged() != 2 {
+		t.Fatalf("unexpected clusters: %d users, %d clusters", res.Users, len(res.Clusters))
+	}
+	sharon := res.Clusters[0]
+	if !reflect.DeepEqual(sharon.IDs, []int{0, 2}) ||
+		!reflect.DeepEqual(sharon.User.Browsers, []string{"Android", "MSIE", "Chrome"}) ||
+		sharon.User.Email != "sharoncrawford@gmail.com" || sharon.User.Country != "Kenya" {
+		t.Errorf("bad cluster: %+v", sharon)
+	}
+
+	users := new(bytes.Buffer)
+	if err := res.WriteUsers(users); err != nil {
+		t.Fatal(err)
+	}
+	expectedUsers := `{"browsers":["Android","MSIE","Chrome"],"company":"Muxo","country":"Kenya","email":"sharoncrawford@gmail.com","name":"Sharon Crawford","phone":"1-2-3"}
+{"browsers":["Opera"],"country":"Malta","email":"bob@muxo.edu","name":"Bob"}
+{"browsers":["Opera"],"country":"Peru","email":"bob@muxo.edu","name":"Robert"}
+`
+	if users.String() != expectedUsers {
+		t.Errorf("bad users:\n%s", users)
+	}
+
+	report := new(bytes.Buffer)
+	res.WriteReport(report)
+	expectedReport := `users 5
+unique 3
+merged 2
+
+[0] Sharon Crawford <sharoncrawford@gmail.com> <- 2: Sharon.Crawford@Gmail.com,  sharoncrawford+shop@googlemail.com
+[1] Bob <bob@muxo.edu> <- 4: bob@muxo.edu, bob@Muxo.edu.
+`
+	if report.String() != expectedReport {
+		t.Errorf("bad report:\n%s", report)
+	}
+
+	// результат снова читается как users.txt и больше не сжимается
+	in, _ = NewInput(bytes.NewReader(users.Bytes()))
+	again, err := Dedup(in)
+	if err != nil || again.Merged() != 0 {
+		t.Errorf("dedup output is not stable: %v, %d merged", err, again.Merged())
+	}
+}
+
+func TestDedupUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hw3_dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "users.jsonl")
+	report := new(bytes.Buffer)
+	DedupUsers(filePath, dst, report)
+	if !strings.HasPrefix(report.String(), "users 1000\nunique 1000\nmerged 0\n") {
+		t.Errorf("bad report:\n%s", report)
+	}
+	data, _ := ioutil.ReadFile(dst)
+	if n := bytes.Count(data, []byte("\n")); n != 1000 {
+		t.Errorf("expected 1000 users, got %d", n)
+	}
+
+	// записи переписываются целиком, не только разобранные в user поля
+	src, _ := ioutil.ReadFile(filePath)
+	var first, written map[string]interface{}
+	json.Unmarshal(src[:bytes.IndexByte(src, '\n')], &first)
+	json.Unmarshal(data[:bytes.IndexByte(data, '\n')], &written)
+	first["email"] = NormalizeEmail(first["email"].(string))
+	if !reflect.DeepEqual(written, first) {
+		t.Errorf("user not preserved:\n%v\n%v", written, first)
+	}
+}
@@ -1,69 +1,106 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
 	"io"
-	"os"
-	"strings"
+
+	"coursera/hw3_bench/jsonl"
 )
 
 type user struct {
 	Name     string   `json:"name"`
 	Email    string   `json:"email"`
+	Country  string   `json:"country"`
+	Browsers []string `json:"browsers"`
+}
+
+// userBrief - тот же user, но country при разборе пропускается: строка
+// страны не копируется, если запрос её не проверяет.
+type userBrief struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Country  string   `json:"-"`
 	Browsers []string `json:"browsers"`
 }
 
+// lineTarget возвращает, во что разбирать строку для проверки запросом q.
+func (q *Query) lineTarget(u *user) jsonl.Unmarshaler {
+	if q.usesCountry {
+		return u
+	}
+	return (*userBrief)(u)
+}
+
+var androidAndMSIE = MustCompileQuery(AndroidAndMSIEQuery)
+
 // вам надо написать более быструю оптимальную этой функции
 func FastSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+	QuerySearch(out, androidAndMSIE)
+}
+
+// QuerySearch выводит пользователей, подходящих под q, в том же формате,
+// что и FastSearch. "Total unique browsers" считается по браузерам,
+// упомянутым в условиях q на browsers.
+func QuerySearch(out io.Writer, q *Query) {
+	QuerySearchFormat(out, q, OutputOptions{})
+}
+
+// QuerySearchFormat как QuerySearch, но в формате opts.
+func QuerySearchFormat(out io.Writer, q *Query, opts OutputOptions) {
+	querySearchFile(out, filePath, q, opts)
+}
+
+// querySearchFile - QuerySearchFormat по файлу path.
+func querySearchFile(out io.Writer, path string, q *Query, opts OutputOptions) {
+	in, err := OpenInput(path, InputOptions{})
 	if err != nil {
 		panic(err)
 	}
+	defer in.Close()
+
+	if err := SearchInput(out, in, q, opts); err != nil {
+		panic(err)
+	}
+}
 
-	r := strings.NewReplacer("@", " [at] ")
+// SearchInput ищет пользователей, подходящих под q, в произвольном источнике.
+func SearchInput(out io.Writer, in *Input, q *Query, opts OutputOptions) error {
 	seenBrowsers := make(map[string]bool)
+	track := func(browser string) {
+		seenBrowsers[browser] = true
+	}
+	scratch := q.newScratch()
 
-	fmt.Fprintln(out, "found users:")
+	w := newResultWriter(out, opts)
+	w.begin()
 
-	scanner := bufio.NewScanner(file)
-	for id := 0; scanner.Scan(); id++ {
-		user := new(user)
-		err := user.UnmarshalJSON(scanner.Bytes())
-		if err != nil {
-			panic(err)
-		}
+	var lines *jsonl.Reader
+	if in.data != nil {
+		lines = in.Lines()
+	} else {
+		// буфер на 64K берём из пула, как searchChunk
+		lines = lineReaderPool.Get().(*jsonl.Reader)
+		defer lineReaderPool.Put(lines)
+		lines.Reset(in)
+	}
 
-		isAndroid := false
-		isMSIE := false
-
-		for _, browser := range user.Browsers {
-			if strings.Contains(browser, "Android") {
-				isAndroid = true
-				if !seenBrowsers[browser] {
-					// log.Printf("SLOW New browser: %s, first seen: %s", browser, user["name"])
-					seenBrowsers[browser] = true
-				}
-			}
-
-			if strings.Contains(browser, "MSIE") {
-				isMSIE = true
-				if !seenBrowsers[browser] {
-					// log.Printf("SLOW New browser: %s, first seen: %s", browser, user["name"])
-					seenBrowsers[browser] = true
-				}
-			}
+	u := &user{}
+	target := q.lineTarget(u)
+	for id := 0; ; id++ {
+		*u = user{Browsers: u.Browsers[:0]}
+		if !lines.Next(target) {
+			break
 		}
 
-		if !(isAndroid && isMSIE) {
+		if !q.matchTracked(u, scratch, track) {
 			continue
 		}
 
 		// log.Println("Android and MSIE user:", user["name"], user["email"])
-		email := r.Replace(user.Email)
-		fmt.Fprintf(out, "[%d] %s <%s>\n", id, user.Name, email)
+		w.user(id, u.Name, u.Email)
 	}
 
-	fmt.Fprintln(out)
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	if err := lines.Err(); err != nil {
+		return err
+	}
+	return w.end(len(seenBrowsers))
 }
@@ -17,7 +17,7 @@ var (
 	_ easyjson.Marshaler
 )
 
-func easyjson3486653aDecodeCourseraHw3Bench(in *jlexer.Lexer, out *user) {
+func easyjson3486653aDecodeCourseraHw3Bench(in *jlexer.Lexer, out *userBrief) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -28,18 +28,21 @@ func easyjson3486653aDecodeCourseraHw3Bench(in *jlexer.Lexer, out *user) {
 	}
 	in.Delim('{')
 	for !in.IsDelim('}') {
-		key := in.UnsafeString()
+		key := in.UnsafeFieldName(false)
 		in.WantColon()
-		if in.IsNull() {
-			in.Skip()
-			in.WantComma()
-			continue
-		}
 		switch key {
 		case "name":
-			out.Name = string(in.String())
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.Name = string(in.String())
+			}
 		case "email":
-			out.Email = string(in.String())
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.Email = string(in.String())
+			}
 		case "browsers":
 			if in.IsNull() {
 				in.Skip()
@@ -57,7 +60,11 @@ func easyjson3486653aDecodeCourseraHw3Bench(in *jlexer.Lexer, out *user) {
 				}
 				for !in.IsDelim(']') {
 					var v1 string
-					v1 = string(in.String())
+					if in.IsNull() {
+						in.Skip()
+					} else {
+						v1 = string(in.String())
+					}
 					out.Browsers = append(out.Browsers, v1)
 					in.WantComma()
 				}
@@ -73,38 +80,23 @@ func easyjson3486653aDecodeCourseraHw3Bench(in *jlexer.Lexer, out *user) {
 		in.Consumed()
 	}
 }
-func easyjson3486653aEncodeCourseraHw3Bench(out *jwriter.Writer, in user) {
+func easyjson3486653aEncodeCourseraHw3Bench(out *jwriter.Writer, in userBrief) {
 	out.RawByte('{')
 	first := true
 	_ = first
 	{
 		const prefix string = ",\"name\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix[1:])
 		out.String(string(in.Name))
 	}
 	{
 		const prefix string = ",\"email\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		out.String(string(in.Email))
 	}
 	{
 		const prefix string = ",\"browsers\":"
-		if first {
-			first = false
-			out.RawString(prefix[1:])
-		} else {
-			out.RawString(prefix)
-		}
+		out.RawString(prefix)
 		if in.Browsers == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
 			out.RawString("null")
 		} else {
@@ -122,25 +114,155 @@ func easyjson3486653aEncodeCourseraHw3Bench(out *jwriter.Writer, in user) {
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v user) MarshalJSON() ([]byte, error) {
+func (v userBrief) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
 	easyjson3486653aEncodeCourseraHw3Bench(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v user) MarshalEasyJSON(w *jwriter.Writer) {
+func (v userBrief) MarshalEasyJSON(w *jwriter.Writer) {
 	easyjson3486653aEncodeCourseraHw3Bench(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *user) UnmarshalJSON(data []byte) error {
+func (v *userBrief) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
 	easyjson3486653aDecodeCourseraHw3Bench(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *user) UnmarshalEasyJSON(l *jlexer.Lexer) {
+func (v *userBrief) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjson3486653aDecodeCourseraHw3Bench(l, v)
 }
+func easyjson3486653aDecodeCourseraHw3Bench1(in *jlexer.Lexer, out *user) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		switch key {
+		case "name":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.Name = string(in.String())
+			}
+		case "email":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.Email = string(in.String())
+			}
+		case "country":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.Country = string(in.String())
+			}
+		case "browsers":
+			if in.IsNull() {
+				in.Skip()
+				out.Browsers = nil
+			} else {
+				in.Delim('[')
+				if out.Browsers == nil {
+					if !in.IsDelim(']') {
+						out.Browsers = make([]string, 0, 4)
+					} else {
+						out.Browsers = []string{}
+					}
+				} else {
+					out.Browsers = (out.Browsers)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v4 string
+					if in.IsNull() {
+						in.Skip()
+					} else {
+						v4 = string(in.String())
+					}
+					out.Browsers = append(out.Browsers, v4)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson3486653aEncodeCourseraHw3Bench1(out *jwriter.Writer, in user) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"name\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Name))
+	}
+	{
+		const prefix string = ",\"email\":"
+		out.RawString(prefix)
+		out.String(string(in.Email))
+	}
+	{
+		const prefix string = ",\"country\":"
+		out.RawString(prefix)
+		out.String(string(in.Country))
+	}
+	{
+		const prefix string = ",\"browsers\":"
+		out.RawString(prefix)
+		if in.Browsers == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v5, v6 := range in.Browsers {
+				if v5 > 0 {
+					out.RawByte(',')
+				}
+				out.String(string(v6))
+			}
+			out.RawByte(']')
+		}
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v user) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson3486653aEncodeCourseraHw3Bench1(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v user) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson3486653aEncodeCourseraHw3Bench1(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *user) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson3486653aDecodeCourseraHw3Bench1(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *user) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson3486653aDecodeCourseraHw3Bench1(l, v)
+}
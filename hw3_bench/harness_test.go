@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+// Стенд для сравнения реализаций поиска: генерирует синтетические users.txt,
+// прогоняет на них все зарегистрированные реализации, проверяет, что вывод
+// у всех одинаковый, и печатает таблицу ns/op, B/op, allocs/op. Таблица
+// не содержит ничего, что меняется от запуска к запуску, кроме самих цифр,
+// так что её удобно сохранять и сравнивать diff'ом между коммитами.
+
+// SearchImpl - реализация поиска Android и MSIE по файлу path.
+type SearchImpl struct {
+	Name   string
+	Search func(out io.Writer, path string)
+}
+
+var searchImpls []SearchImpl
+
+// RegisterSearch добавляет реализацию в стенд. Первая зарегистрированная
+// считается эталонной: с её выводом сравниваются остальные.
+func RegisterSearch(name string, search func(out io.Writer, path string)) {
+	searchImpls = append(searchImpls, SearchImpl{Name: name, Search: search})
+}
+
+func init() {
+	RegisterSearch("slow", slowSearchFile)
+	RegisterSearch("fast", func(out io.Writer, path string) {
+		querySearchFile(out, path, androidAndMSIE, OutputOptions{})
+	})
+	RegisterSearch("parallel", func(out io.Writer, path string) {
+		parallelSearchFile(out, path, androidAndMSIE, 0, OutputOptions{})
+	})
+	RegisterSearch("indexed", func(out io.Writer, path string) {
+		indexedSearchFile(out, path, androidAndMSIE)
+	})
+}
+
+// BrowserFamily - шаблон строки браузера с одним %d, вместо которого
+// подставляется версия от 1 до Versions. Weight - относительная частота.
+type BrowserFamily struct {
+	Template string
+	Versions int
+	Weight   int
+}
+
+// DefaultBrowserFamilies примерно повторяют состав data/users.txt.
+var DefaultBrowserFamilies = []BrowserFamily{
+	{"Mozilla/5.0 (Windows NT 6.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.2228.0 Safari/537.36", 40, 30},
+	{"Mozilla/5.0 (Windows NT 6.1; WOW64; rv:%d.0) Gecko/20100101 Firefox/40.1", 40, 20},
+	{"Mozilla/4.0 (compatible; MSIE %d.0; Windows NT 5.1; SV1)", 10, 15},
+	{"Mozilla/5.0 (Linux; U; Android 4.0.%d; en-us; GT-I9100 Build/IML74K) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30", 5, 15},
+	{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_9_3) AppleWebKit/537.75.14 (KHTML, like Gecko) Version/7.0.%d Safari/7046A194A", 5, 10},
+	{"Opera/9.80 (Windows NT 6.0) Presto/2.12.388 Version/12.%d", 20, 10},
+}
+
+var datasetCountries = []string{"Kenya", "Malta", "Peru", "Norway", "Dominican Republic", "Japan"}
+
+// DatasetConfig - параметры синтетического набора пользователей.
+type DatasetConfig struct {
+	Users int
+	// у каждого пользователя от MinBrowsers до MaxBrowsers браузеров
+	MinBrowsers, MaxBrowsers int
+	// Browsers - распределение браузеров, по умолчанию DefaultBrowserFamilies.
+	Browsers []BrowserFamily
+	// Seed делает набор воспроизводимым.
+	Seed int64
+}
+
+func (cfg DatasetConfig) String() string {
+	return fmt.Sprintf("users=%d browsers=%d..%d seed=%d", cfg.Users, cfg.MinBrowsers, cfg.MaxBrowsers, cfg.Seed)
+}
+
+// GenerateUsers пишет cfg.Users JSON-строк в формате data/users.txt.
+// Как и в исходном файле, после последней строки нет перевода строки.
+func GenerateUsers(out io.Writer, cfg DatasetConfig) error {
+	families := cfg.Browsers
+	if len(families) == 0 {
+		families = DefaultBrowserFamilies
+	}
+	totalWeight := 0
+	for _, f := range families {
+		totalWeight += f.Weight
+	}
+	if totalWeight <= 0 || cfg.Users <= 0 || cfg.MinBrowsers < 0 || cfg.MaxBrowsers < cfg.MinBrowsers {
+		return fmt.Errorf("bad dataset config: %s", cfg)
+	}
+
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	browser := func() string {
+		n := rnd.Intn(totalWeight)
+		for _, f := range families {
+			if n < f.Weight {
+				return fmt.Sprintf(f.Template, 1+rnd.Intn(f.Versions))
+			}
+			n -= f.Weight
+		}
+		panic("unreachable")
+	}
+
+	w := bufio.NewWriter(out)
+	var line []byte
+	for i := 0; i < cfg.Users; i++ {
+		line = append(line[:0], `{"browsers":[`...)
+		n := cfg.MinBrowsers + rnd.Intn(cfg.MaxBrowsers-cfg.MinBrowsers+1)
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				line = append(line, ',')
+			}
+			line = appendJSONString(line, browser())
+		}
+		line = append(line, `],"company":"Company`...)
+		line = append(line, fmt.Sprint(rnd.Intn(100))...)
+		line = append(line, `","country":`...)
+		line = appendJSONString(line, datasetCountries[rnd.Intn(len(datasetCountries))])
+		line = append(line, fmt.Sprintf(`,"email":"user%d@example%d.com","job":"Programmer","name":"User %d","phone":"%03d-%02d-%02d"}`,
+			i, rnd.Intn(10), i, rnd.Intn(1000), rnd.Intn(100), rnd.Intn(100))...)
+		if i < cfg.Users-1 {
+			line = append(line, '\n')
+		}
+		w.Write(line)
+	}
+	return w.Flush()
+}
+
+// HarnessResult - замер одной реализации на одном наборе.
+type HarnessResult struct {
+	Dataset     DatasetConfig
+	Impl        string
+	NsPerOp     int64
+	BytesPerOp  int64
+	AllocsPerOp int64
+}
+
+// CheckHarness проверяет, что на всех наборах все реализации выводят одно и то же.
+func CheckHarness(datasets []DatasetConfig) error {
+	return eachDataset(datasets, checkSameOutput)
+}
+
+// RunHarness для каждого набора проверяет вывод, как CheckHarness, и
+// замеряет все реализации. Расхождение в выводе - ошибка, замеры после
+// неё не делаются.
+func RunHarness(datasets []DatasetConfig) ([]HarnessResult, error) {
+	var results []HarnessResult
+	err := eachDataset(datasets, func(cfg DatasetConfig, path string) error {
+		if err := checkSameOutput(cfg, path); err != nil {
+			return err
+		}
+		for _, impl := range searchImpls {
+			search := impl.Search
+			res := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					search(ioutil.Discard, path)
+				}
+			})
+			results = append(results, HarnessResult{
+				Dataset:     cfg,
+				Impl:        impl.Name,
+				NsPerOp:     res.NsPerOp(),
+				BytesPerOp:  res.AllocedBytesPerOp(),
+				AllocsPerOp: res.AllocsPerOp(),
+			})
+		}
+		return nil
+	})
+	return results, err
+}
+
+// eachDataset генерирует наборы по очереди во временной папке и вызывает
+// fn для каждого сгенерированного файла.
+func eachDataset(datasets []DatasetConfig, fn func(cfg DatasetConfig, path string) error) error {
+	dir, err := ioutil.TempDir("", "hw3_harness")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for i, cfg := range datasets {
+		path := filepath.Join(dir, fmt.Sprintf("users%d.txt", i))
+		if err := generateUsersFile(path, cfg); err != nil {
+			return err
+		}
+		if err := fn(cfg, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateUsersFile(path string, cfg DatasetConfig) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := GenerateUsers(file, cfg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func checkSameOutput(cfg DatasetConfig, path string) error {
+	var expected []byte
+	for i, impl := range searchImpls {
+		out := new(bytes.Buffer)
+		impl.Search(out, path)
+		if i == 0 {
+			expected = out.Bytes()
+			continue
+		}
+		if !bytes.Equal(out.Bytes(), expected) {
+			return fmt.Errorf("%s: %s output differs from %s\nGot:\n%s\nExpected:\n%s",
+				cfg, impl.Name, searchImpls[0].Name, out.Bytes(), expected)
+		}
+	}
+	return nil
+}
+
+// WriteHarnessTable печатает результаты таблицей, по строке на пару
+// набор-реализация, в порядке замеров.
+func WriteHarnessTable(out io.Writer, results []HarnessResult) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "users\tbrowsers\tseed\timpl\tns/op\tB/op\tallocs/op\t\n")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%d..%d\t%d\t%s\t%d\t%d\t%d\t\n", r.Dataset.Users,
+			r.Dataset.MinBrowsers, r.Dataset.MaxBrowsers, r.Dataset.Seed, r.Impl, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+	}
+	return w.Flush()
+}
+
+// go test -run TestHarnessReport -harness > bench.txt
+var harness = flag.Bool("harness", false, "замерить все реализации на синтетических наборах и вывести таблицу")
+
+var harnessDatasets = []DatasetConfig{
+	{Users: 1000, MinBrowsers: 1, MaxBrowsers: 6, Seed: 1},
+	{Users: 10000, MinBrowsers: 1, MaxBrowsers: 6, Seed: 2},
+	{Users: 10000, MinBrowsers: 10, MaxBrowsers: 20, Seed: 3},
+}
+
+func TestGenerateUsers(t *testing.T) {
+	cfg := DatasetConfig{Users: 50, MinBrowsers: 2, MaxBrowsers: 3, Seed: 7}
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	if err := GenerateUsers(first, cfg); err != nil {
+		t.Fatal(err)
+	}
+	GenerateUsers(second, cfg)
+	if first.String() != second.String() {
+		t.Errorf("same seed gives different datasets")
+	}
+
+	in, _ := NewInput(bytes.NewReader(first.Bytes()))
+	lines := in.Lines()
+	n := 0
+	for u := new(user); lines.Next(u); u = new(user) {
+		if len(u.Browsers) < 2 || len(u.Browsers) > 3 || u.Email == "" || u.Country == "" {
+			t.Errorf("bad user: %+v", u)
+		}
+		n++
+	}
+	if lines.Err() != nil || n != cfg.Users || strings.HasSuffix(first.String(), "\n") {
+		t.Errorf("bad dataset: %v, %d users", lines.Err(), n)
+	}
+
+	for _, bad := range []DatasetConfig{
+		{},
+		{Users: 1, MinBrowsers: 3, MaxBrowsers: 2},
+		{Users: 1, MaxBrowsers: 1, Browsers: []BrowserFamily{{"x%d", 1, 0}}},
+	} {
+		if err := GenerateUsers(new(bytes.Buffer), bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestHarnessSameOutput(t *testing.T) {
+	datasets := []DatasetConfig{
+		{Users: 300, MinBrowsers: 0, MaxBrowsers: 8, Seed: 1},
+		{Users: 1, MinBrowsers: 1, MaxBrowsers: 1, Seed: 2},
+	}
+	if err := CheckHarness(datasets); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHarnessDetectsMismatch(t *testing.T) {
+	defer func(impls []SearchImpl) { searchImpls = impls }(searchImpls)
+	RegisterSearch("broken", func(out io.Writer, path string) {
+		out.Write([]byte("found users:\n"))
+	})
+	err := CheckHarness([]DatasetConfig{{Users: 10, MinBrowsers: 1, MaxBrowsers: 2}})
+	if err == nil || !strings.Contains(err.Error(), "broken output differs from slow") {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
+
+func TestHarnessReport(t *testing.T) {
+	if !*harness {
+		t.Skip("run with -harness")
+	}
+	results, err := RunHarness(harnessDatasets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WriteHarnessTable(os.Stdout, results)
+}
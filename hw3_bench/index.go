@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Индекс для повторных запросов по одному и тому же users.txt.
+//
+// Для каждой различной строки браузера хранится отсортированный список id
+// пользователей, у которых она есть, а для каждого пользователя - name,
+// email, country и номера его браузеров. Поэтому любой запрос отвечается
+// без разбора JSON: условия browsers ~ / = без отрицания, стоящие в корне
+// запроса через AND, сужают кандидатов пересечением списков, остальное
+// проверяется обычным Query.Match.
+//
+// Формат файла (все числа - uvarint, строки - длина и байты):
+//
+//	"hw3index" версия
+//	размер исходного файла, mtime в наносекундах
+//	число браузеров, для каждого: строка, число id, id дельтами
+//	число пользователей, для каждого: name, email, country, число браузеров, номера
+//	crc32 (IEEE, little-endian) всего предыдущего
+//
+// Индекс считается устаревшим, если размер или mtime исходного файла
+// не совпадают с записанными.
+
+const (
+	indexMagic   = "hw3index"
+	indexVersion = 1
+)
+
+var errIndexCorrupted = errors.New("index: corrupted")
+
+type Index struct {
+	// SourceSize и SourceModTime - размер и mtime (в наносекундах)
+	// файла, по которому построен индекс.
+	SourceSize    int64
+	SourceModTime int64
+
+	browsers []string
+	postings [][]uint32
+	users    []indexUser
+}
+
+type indexUser struct {
+	name, email, country string
+	browsers             []uint32
+}
+
+// BuildIndex строит индекс по пользователям из in.
+func BuildIndex(in *Input) (*Index, error) {
+	idx := &Index{}
+	browserIDs := make(map[string]uint32)
+
+	lines := in.Lines()
+	u := &user{}
+	for id := uint32(0); ; id++ {
+		*u = user{Browsers: u.Browsers[:0]}
+		if !lines.Next(u) {
+			break
+		}
+		iu := indexUser{name: u.Name, email: u.Email, country: u.Country}
+		for _, browser := range u.Browsers {
+			bid, ok := browserIDs[browser]
+			if !ok {
+				bid = uint32(len(idx.browsers))
+				browserIDs[browser] = bid
+				idx.browsers = append(idx.browsers, browser)
+				idx.postings = append(idx.postings, nil)
+			}
+			iu.browsers = append(iu.browsers, bid)
+			// id растут, так что повтор браузера у пользователя - всегда последний элемент
+			if p := idx.postings[bid]; len(p) == 0 || p[len(p)-1] != id {
+				idx.postings[bid] = append(p, id)
+			}
+		}
+		idx.users = append(idx.users, iu)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// BuildIndexFile строит индекс по файлу path и запоминает его размер и mtime.
+// Файл читается через буфер, а не отображается в память: его могут
+// переписать или обрезать прямо во время чтения, и с отображением это SIGBUS.
+func BuildIndexFile(path string) (*Index, error) {
+	in, err := OpenInput(path, InputOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := BuildIndex(in)
+	if err != nil {
+		return nil, err
+	}
+	idx.SourceSize, idx.SourceModTime = info.Size(), info.ModTime().UnixNano()
+	return idx, nil
+}
+
+// Fresh сообщает, построен ли индекс по текущей версии файла path.
+func (idx *Index) Fresh(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.Size() == idx.SourceSize && info.ModTime().UnixNano() == idx.SourceModTime, nil
+}
+
+// LoadIndex читает индекс из indexPath. Если его нет, он повреждён или
+// устарел относительно sourcePath, индекс строится заново и сохраняется.
+func LoadIndex(indexPath, sourcePath string) (*Index, error) {
+	idx, err := ReadIndexFile(indexPath)
+	if err == nil {
+		fresh, err := idx.Fresh(sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		if fresh {
+			return idx, nil
+		}
+	} else if !os.IsNotExist(err) && err != errIndexCorrupted {
+		return nil, err
+	}
+
+	idx, err = BuildIndexFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	return idx, idx.WriteFile(indexPath)
+}
+
+// ReadIndexFile читает индекс из файла без проверки актуальности.
+func ReadIndexFile(path string) (*Index, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadIndex(data)
+}
+
+// WriteFile атомарно сохраняет индекс: пишет во временный файл рядом и
+// переименовывает его, так что читатели не увидят недописанный индекс.
+func (idx *Index) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(idx.encode()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// WriteTo пишет индекс в двоичном формате.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(idx.encode())
+	return int64(n), err
+}
+
+func (idx *Index) encode() []byte {
+	b := append([]byte(indexMagic), indexVersion)
+	b = binary.AppendUvarint(b, uint64(idx.SourceSize))
+	b = binary.AppendUvarint(b, uint64(idx.SourceModTime))
+
+	b = binary.AppendUvarint(b, uint64(len(idx.browsers)))
+	for i, browser := range idx.browsers {
+		b = appendIndexString(b, browser)
+		b = binary.AppendUvarint(b, uint64(len(idx.postings[i])))
+		prev := uint32(0)
+		for _, id := range idx.postings[i] {
+			b = binary.AppendUvarint(b, uint64(id-prev))
+			prev = id
+		}
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(idx.users)))
+	for _, u := range idx.users {
+		b = appendIndexString(b, u.name)
+		b = appendIndexString(b, u.email)
+		b = appendIndexString(b, u.country)
+		b = binary.AppendUvarint(b, uint64(len(u.browsers)))
+		for _, bid := range u.browsers {
+			b = binary.AppendUvarint(b, uint64(bid))
+		}
+	}
+
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func appendIndexString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// ReadIndex разбирает индекс, записанный WriteTo.
+func ReadIndex(data []byte) (*Index, error) {
+	if len(data) < len(indexMagic)+1+4 || !bytes.HasPrefix(data, []byte(indexMagic)) {
+		return nil, errIndexCorrupted
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum) {
+		return nil, errIndexCorrupted
+	}
+	// индекс другой версии не разобрать - LoadIndex перестроит его, как повреждённый
+	if body[len(indexMagic)] != indexVersion {
+		return nil, errIndexCorrupted
+	}
+
+	d := &indexDecoder{b: body[len(indexMagic)+1:]}
+	idx := &Index{
+		SourceSize:    int64(d.uvarint()),
+		SourceModTime: int64(d.uvarint()),
+	}
+
+	nBrowsers := d.count()
+	idx.browsers = make([]string, nBrowsers)
+	idx.postings = make([][]uint32, nBrowsers)
+	for i := range idx.browsers {
+		idx.browsers[i] = d.string()
+		postings := make([]uint32, d.count())
+		prev := uint32(0)
+		for j := range postings {
+			prev += uint32(d.uvarint())
+			postings[j] = prev
+		}
+		idx.postings[i] = postings
+	}
+
+	idx.users = make([]indexUser, d.count())
+	for i := range idx.users {
+		u := &idx.users[i]
+		u.name, u.email, u.country = d.string(), d.string(), d.string()
+		u.browsers = make([]uint32, d.count())
+		for j := range u.browsers {
+			bid := d.uvarint()
+			if bid >= uint64(nBrowsers) {
+				d.err = errIndexCorrupted
+			}
+			u.browsers[j] = uint32(bid)
+		}
+	}
+
+	if d.err == nil && len(d.b) != 0 {
+		d.err = errIndexCorrupted
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return idx, nil
+}
+
+// indexDecoder читает поля подряд; первая ошибка запоминается,
+// после неё все поля читаются как нули.
+type indexDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *indexDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errIndexCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count читает длину списка; она не может быть больше оставшихся байт,
+// иначе повреждённый файл заставил бы выделить огромный срез.
+func (d *indexDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = errIndexCorrupted
+		return 0
+	}
+	return int(n)
+}
+
+func (d *indexDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+// Users - количество пользователей в индексе.
+func (idx *Index) Users() int {
+	return len(idx.users)
+}
+
+// Browsers - количество различных строк браузеров.
+func (idx *Index) Browsers() int {
+	return len(idx.browsers)
+}
+
+// UsersWithBrowser возвращает отсортированные id пользователей, у которых
+// есть браузер, содержащий substr.
+func (idx *Index) UsersWithBrowser(substr string) []int {
+	ids := idx.termPostings(&queryTerm{field: fieldBrowsers, op: opContains, value: substr})
+	res := make([]int, len(ids))
+	for i, id := range ids {
+		res[i] = int(id)
+	}
+	return res
+}
+
+// termPostings объединяет списки всех браузеров, подходящих под term.
+func (idx *Index) termPostings(term *queryTerm) []uint32 {
+	var res []uint32
+	for bid, browser := range idx.browsers {
+		if term.matchString(browser) {
+			res = unionPostings(res, idx.postings[bid])
+		}
+	}
+	return res
+}
+
+func unionPostings(a, b []uint32) []uint32 {
+	if len(a) == 0 {
+		return b
+	}
+	res := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+func intersectPostings(a, b []uint32) []uint32 {
+	res := make([]uint32, 0, len(a))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return res
+}
+
+// candidates возвращает отсортированные id пользователей, которые могут
+// подойти под q.
+// all == true - сузить не удалось, нужно проверить всех.
+func (idx *Index) candidates(q *Query) (ids []uint32, all bool) {
+	var terms []*queryTerm
+	switch root := q.root.(type) {
+	case *queryTerm:
+		terms = append(terms, root)
+	case queryAnd:
+		for _, child := range root {
+			if term, ok := child.(*queryTerm); ok {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	all = true
+	for _, term := range terms {
+		if term.field != fieldBrowsers || term.negate {
+			continue
+		}
+		postings := idx.termPostings(term)
+		if all {
+			ids, all = postings, false
+		} else {
+			ids = intersectPostings(ids, postings)
+		}
+	}
+	return ids, all
+}
+
+// Search отвечает на запрос по индексу в том же виде, что и SearchInput.
+func (idx *Index) Search(out io.Writer, q *Query, opts OutputOptions) error {
+	w := newResultWriter(out, opts)
+	w.begin()
+	idx.Each(q, func(id int, u *user) {
+		w.user(id, u.Name, u.Email)
+	})
+	return w.end(idx.UniqueBrowsers(q))
+}
+
+// UniqueBrowsers - сколько различных браузеров из индекса упомянуто
+// в условиях q на browsers ("Total unique browsers").
+func (idx *Index) UniqueBrowsers(q *Query) int {
+	res := 0
+	scratch := q.newScratch()
+	for bid, browser := range idx.browsers {
+		if len(idx.postings[bid]) > 0 && q.trackBrowser(browser, scratch) {
+			res++
+		}
+	}
+	return res
+}
+
+// Each вызывает fn для каждого подходящего под q пользователя в порядке id.
+// u переиспользуется между вызовами.
+func (idx *Index) Each(q *Query, fn func(id int, u *user)) {
+	u := &user{}
+	scratch := q.newScratch()
+	check := func(id uint32) {
+		iu := &idx.users[id]
+		*u = user{Name: iu.name, Email: iu.email, Country: iu.country, Browsers: u.Browsers[:0]}
+		for _, bid := range iu.browsers {
+			u.Browsers = append(u.Browsers, idx.browsers[bid])
+		}
+		if q.matchTracked(u, scratch, nil) {
+			fn(int(id), u)
+		}
+	}
+
+	ids, all := idx.candidates(q)
+	if all {
+		for id := range idx.users {
+			check(uint32(id))
+		}
+	} else {
+		for _, id := range ids {
+			check(id)
+		}
+	}
+}
+
+// IndexedSearch как QuerySearch, но отвечает по индексу рядом с
+// data/users.txt, при необходимости перестраивая его.
+func IndexedSearch(out io.Writer, q *Query) {
+	indexedSearchFile(out, filePath, q)
+}
+
+// indexedSearchFile - IndexedSearch по файлу path с индексом path.idx.
+func indexedSearchFile(out io.Writer, path string, q *Query) {
+	idx, err := LoadIndex(path+".idx", path)
+	if err != nil {
+		panic(err)
+	}
+	if err := idx.Search(out, q, OutputOptions{}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndexSearch(t *testing.T) {
+	files := writeTestInputs(t)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+
+	idx, err := LoadIndex(filepath.Join(dir, "users.idx"), plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{
+		AndroidAndMSIEQuery,
+		`browsers ~ "Android" AND browsers ~ "MSIE" AND country = "Kenya"`,
+		`browsers = "Mozilla/5.0 (Windows; U; Windows NT 6.0; en-US) AppleWebKit/534.14 (KHTML, like Gecko) Chrome/9.0.601.0 Safari/534.14"`,
+		`browsers ~ "Opera" AND NOT browsers ~ "Windows"`,
+		`browsers ~ "Android" OR country = "Malta"`,
+		`browsers !~ "Mozilla"`,
+		`browsers ~ "NoSuchBrowser"`,
+	} {
+		q := MustCompileQuery(src)
+		expected := new(bytes.Buffer)
+		QuerySearch(expected, q)
+		got := new(bytes.Buffer)
+		if err := idx.Search(got, q, OutputOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != expected.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", src, got, expected)
+		}
+	}
+}
+
+func TestIndexInvalidation(t *testing.T) {
+	files := writeTestInputs(t)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+	idxPath := filepath.Join(dir, "users.idx")
+
+	idx, err := LoadIndex(idxPath, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := idx.Users()
+
+	// тот же файл - индекс читается с диска, а не строится заново
+	stored, _ := ioutil.ReadFile(idxPath)
+	if idx, err = LoadIndex(idxPath, plain); err != nil || idx.Users() != users {
+		t.Fatalf("reload: %v, %d users", err, idx.Users())
+	}
+	if reloaded, _ := ioutil.ReadFile(idxPath); !bytes.Equal(stored, reloaded) {
+		t.Errorf("fresh index was rewritten")
+	}
+
+	// изменился размер
+	data, _ := ioutil.ReadFile(plain)
+	extra := "\n" + `{"browsers":["NewBrowser/1.0"],"name":"New User","email":"new@example.com"}` + "\n"
+	if err := ioutil.WriteFile(plain, append(data, extra...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = LoadIndex(idxPath, plain); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Users() != users+1 || !reflect.DeepEqual(idx.UsersWithBrowser("NewBrowser"), []int{users}) {
+		t.Errorf("index not rebuilt after size change: %d users", idx.Users())
+	}
+
+	// размер тот же, изменился только mtime
+	if err := ioutil.WriteFile(plain, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := ReadIndexFile(idxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SourceSize = int64(len(data))
+	if err := stale.WriteFile(idxPath); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(0, stale.SourceModTime).Add(time.Second)
+	if err := os.Chtimes(plain, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = LoadIndex(idxPath, plain); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Users() != users {
+		t.Errorf("index not rebuilt after mtime change: %d users", idx.Users())
+	}
+}
+
+func TestIndexCorrupted(t *testing.T) {
+	files := writeTestInputs(t)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+	idxPath := filepath.Join(dir, "users.idx")
+
+	idx, err := LoadIndex(idxPath, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(idxPath)
+	for _, bad := range [][]byte{nil, data[:len(data)/2], append([]byte("x"), data[1:]...)} {
+		if _, err := ReadIndex(bad); err != errIndexCorrupted {
+			t.Errorf("expected errIndexCorrupted, got %v", err)
+		}
+	}
+
+	// повреждённый индекс молча перестраивается
+	if err := ioutil.WriteFile(idxPath, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := LoadIndex(idxPath, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Users() != idx.Users() || rebuilt.Browsers() != idx.Browsers() {
+		t.Errorf("rebuilt index differs: %d/%d users", rebuilt.Users(), idx.Users())
+	}
+}
+
+func TestIndexOtherVersion(t *testing.T) {
+	files := writeTestInputs(t)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+	idxPath := filepath.Join(dir, "users.idx")
+
+	idx, err := LoadIndex(idxPath, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(idxPath)
+
+	// индекс другой версии с правильной контрольной суммой
+	other := append([]byte(nil), data...)
+	body := other[:len(other)-4]
+	body[len(indexMagic)] = indexVersion + 1
+	binary.LittleEndian.PutUint32(other[len(body):], crc32.ChecksumIEEE(body))
+	if _, err := ReadIndex(other); err != errIndexCorrupted {
+		t.Errorf("expected errIndexCorrupted, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(idxPath, other, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := LoadIndex(idxPath, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Users() != idx.Users() || rebuilt.Browsers() != idx.Browsers() {
+		t.Errorf("rebuilt index differs: %d/%d users", rebuilt.Users(), idx.Users())
+	}
+	if written, _ := ioutil.ReadFile(idxPath); !bytes.Equal(written, data) {
+		t.Errorf("index of version %d not rewritten", indexVersion+1)
+	}
+}
+
+func BenchmarkIndexSearch(b *testing.B) {
+	files := writeTestInputs(b)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+	idxPath := filepath.Join(dir, "users.idx")
+	if _, err := LoadIndex(idxPath, plain); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx, err := LoadIndex(idxPath, plain)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := idx.Search(ioutil.Discard, androidAndMSIE, OutputOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
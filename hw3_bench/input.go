@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+
+	"coursera/hw3_bench/jsonl"
+)
+
+// Input - источник строк с пользователями: файл или любой io.Reader.
+// Сжатие gzip и zstd определяется автоматически по первым байтам.
+// Несжатый файл можно отобразить в память (InputOptions.Mmap), тогда
+// строки читаются прямо из отображения, без копирования.
+type Input struct {
+	r       io.Reader
+	data    []byte
+	closers []func() error
+}
+
+type InputOptions struct {
+	Mmap bool
+}
+
+// Decompressor открывает распаковывающий поток поверх r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+type compression struct {
+	name  string
+	magic []byte
+	open  Decompressor
+}
+
+var compressions = []*compression{
+	{name: "gzip", magic: []byte{0x1f, 0x8b}, open: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}},
+	{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, open: func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}},
+}
+
+// RegisterDecompressor добавляет или заменяет распаковщик для формата name,
+// файлы которого начинаются с magic.
+func RegisterDecompressor(name string, magic []byte, open Decompressor) {
+	for _, c := range compressions {
+		if c.name == name {
+			c.magic, c.open = magic, open
+			return
+		}
+	}
+	compressions = append(compressions, &compression{name: name, magic: magic, open: open})
+}
+
+// OpenInput открывает файл path.
+func OpenInput(path string, opts InputOptions) (*Input, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		file.Close()
+		return nil, err
+	}
+	compressed := detectCompression(magic[:n]) != nil
+
+	if opts.Mmap && !compressed {
+		data, unmap, err := mmapFile(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		in := &Input{r: bytes.NewReader(data), data: data}
+		in.closers = append(in.closers, unmap)
+		return in, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !compressed {
+		return &Input{r: file, closers: []func() error{file.Close}}, nil
+	}
+	in, err := NewInput(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	in.closers = append(in.closers, file.Close)
+	return in, nil
+}
+
+// NewInput читает из r, распаковывая его при необходимости.
+// Close не закрывает сам r.
+func NewInput(r io.Reader) (*Input, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	c := detectCompression(magic)
+	if c == nil {
+		return &Input{r: br}, nil
+	}
+	dr, err := c.open(br)
+	if err != nil {
+		return nil, fmt.Errorf("%s input: %v", c.name, err)
+	}
+	return &Input{r: dr, closers: []func() error{dr.Close}}, nil
+}
+
+func detectCompression(magic []byte) *compression {
+	for _, c := range compressions {
+		if bytes.HasPrefix(magic, c.magic) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (in *Input) Read(p []byte) (int, error) {
+	return in.r.Read(p)
+}
+
+// Lines возвращает построчный reader; для отображённого в память файла
+// строки не копируются.
+func (in *Input) Lines() *jsonl.Reader {
+	if in.data != nil {
+		return jsonl.NewReaderBytes(in.data)
+	}
+	return jsonl.NewReader(in.r)
+}
+
+// Close освобождает распаковщик, отображение и файл.
+func (in *Input) Close() error {
+	var firstErr error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if err := in.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	in.closers = nil
+	return firstErr
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// mmapFile без mmap просто читает файл целиком.
+func mmapFile(file *os.File) ([]byte, func() error, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// testInputs - data/users.txt во временной папке: как есть, в gzip и в zstd.
+type testInputs struct {
+	dir, plain, gz, zst string
+}
+
+func writeTestInputs(tb testing.TB) testInputs {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "hw3_input")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	files := testInputs{
+		dir:   dir,
+		plain: filepath.Join(dir, "users.txt"),
+		gz:    filepath.Join(dir, "users.txt.gz"),
+		zst:   filepath.Join(dir, "users.txt.zst"),
+	}
+
+	gzBuf := new(bytes.Buffer)
+	gw := gzip.NewWriter(gzBuf)
+	gw.Write(data)
+	gw.Close()
+
+	zstBuf := new(bytes.Buffer)
+	zw, err := zstd.NewWriter(zstBuf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	zw.Write(data)
+	zw.Close()
+
+	for path, content := range map[string][]byte{
+		files.plain: data,
+		files.gz:    gzBuf.Bytes(),
+		files.zst:   zstBuf.Bytes(),
+	} {
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return files
+}
+
+func searchInput(t *testing.T, in *Input, err error) string {
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out := new(bytes.Buffer)
+	if err := SearchInput(out, in, androidAndMSIE, OutputOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestInputSources(t *testing.T) {
+	files := writeTestInputs(t)
+	defer os.RemoveAll(files.dir)
+
+	expectedOut := new(bytes.Buffer)
+	FastSearch(expectedOut)
+	expected := expectedOut.String()
+
+	plainData, _ := ioutil.ReadFile(files.plain)
+	gzData, _ := ioutil.ReadFile(files.gz)
+	zstData, _ := ioutil.ReadFile(files.zst)
+
+	sources := map[string]func() (*Input, error){
+		"plain": func() (*Input, error) { return OpenInput(files.plain, InputOptions{}) },
+		"mmap":  func() (*Input, error) { return OpenInput(files.plain, InputOptions{Mmap: true}) },
+		"gzip":  func() (*Input, error) { return OpenInput(files.gz, InputOptions{}) },
+		"zstd":  func() (*Input, error) { return OpenInput(files.zst, InputOptions{}) },
+		"gzip with mmap option": func() (*Input, error) {
+			return OpenInput(files.gz, InputOptions{Mmap: true})
+		},
+		"reader":      func() (*Input, error) { return NewInput(bytes.NewReader(plainData)) },
+		"gzip reader": func() (*Input, error) { return NewInput(bytes.NewReader(gzData)) },
+		"zstd reader": func() (*Input, error) { return NewInput(bytes.NewReader(zstData)) },
+	}
+	for name, open := range sources {
+		in, err := open()
+		if got := searchInput(t, in, err); got != expected {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, got, expected)
+		}
+	}
+}
+
+func TestInputBadCompressed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"gzip": {0x1f, 0x8b, 0},
+		"zstd": {0x28, 0xb5, 0x2f, 0xfd, 0},
+	} {
+		in, err := NewInput(bytes.NewReader(data))
+		if err == nil {
+			err = SearchInput(ioutil.Discard, in, androidAndMSIE, OutputOptions{})
+			in.Close()
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestInputEmpty(t *testing.T) {
+	in, err := NewInput(bytes.NewReader(nil))
+	out := searchInput(t, in, err)
+	if out != "found users:\n\nTotal unique browsers 0\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func benchmarkInput(b *testing.B, open func(files testInputs) (*Input, error)) {
+	files := writeTestInputs(b)
+	defer os.RemoveAll(files.dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in, err := open(files)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := SearchInput(ioutil.Discard, in, androidAndMSIE, OutputOptions{}); err != nil {
+			b.Fatal(err)
+		}
+		in.Close()
+	}
+}
+
+func BenchmarkInputPlain(b *testing.B) {
+	benchmarkInput(b, func(files testInputs) (*Input, error) {
+		return OpenInput(files.plain, InputOptions{})
+	})
+}
+
+func BenchmarkInputMmap(b *testing.B) {
+	benchmarkInput(b, func(files testInputs) (*Input, error) {
+		return OpenInput(files.plain, InputOptions{Mmap: true})
+	})
+}
+
+func BenchmarkInputGzip(b *testing.B) {
+	benchmarkInput(b, func(files testInputs) (*Input, error) {
+		return OpenInput(files.gz, InputOptions{})
+	})
+}
+
+func BenchmarkInputZstd(b *testing.B) {
+	benchmarkInput(b, func(files testInputs) (*Input, error) {
+		return OpenInput(files.zst, InputOptions{})
+	})
+}
+
+// BenchmarkInputReader - NewInput поверх произвольного io.Reader, без файла.
+func BenchmarkInputReader(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in, err := NewInput(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := SearchInput(ioutil.Discard, in, androidAndMSIE, OutputOptions{}); err != nil {
+			b.Fatal(err)
+		}
+		in.Close()
+	}
+}
@@ -0,0 +1,235 @@
+// Package jsonl читает файлы в формате JSON lines: один JSON-объект на строку.
+//
+//	r := jsonl.NewReader(file)
+//	u := &user{}
+//	for r.Next(u) {
+//		// r.Line() - номер строки, из которой прочитан u
+//	}
+//	if err := r.Err(); err != nil {
+//		// *jsonl.LineError с номером строки
+//	}
+//
+// Строки не копируются: Bytes и данные, переданные в UnmarshalJSON, указывают
+// во внутренний буфер и действительны до следующего вызова Next/NextLine.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxLineSize - ограничение на длину строки по умолчанию.
+const DefaultMaxLineSize = 1 << 20
+
+var ErrLineTooLong = errors.New("jsonl: line too long")
+
+// LineError - ошибка разбора конкретной строки.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("jsonl: line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Unmarshaler реализуют типы, сгенерированные easyjson, и любые json.Unmarshaler.
+type Unmarshaler interface {
+	UnmarshalJSON(data []byte) error
+}
+
+type Reader struct {
+	// MaxLineSize - максимальная длина строки без перевода строки.
+	// Более длинные строки считаются ошибочными (ErrLineTooLong).
+	MaxLineSize int
+	// SkipBad - пропускать строки, которые не удалось разобрать, вместо
+	// того чтобы останавливаться. Ошибки передаются в OnError.
+	SkipBad bool
+	OnError func(err *LineError)
+
+	r       *bufio.Reader
+	src     []byte
+	fromSrc bool
+	line    int
+	data    []byte
+	long    []byte
+	err     error
+	skipped int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return NewReaderSize(r, 64*1024)
+}
+
+// NewReaderSize как NewReader, но с буфером размера size. Строки короче
+// буфера читаются без копирования.
+func NewReaderSize(r io.Reader, size int) *Reader {
+	return &Reader{
+		MaxLineSize: DefaultMaxLineSize,
+		r:           bufio.NewReaderSize(r, size),
+	}
+}
+
+// NewReaderBytes читает строки прямо из data, без промежуточного буфера.
+// Удобно для файлов, отображённых в память.
+func NewReaderBytes(data []byte) *Reader {
+	return &Reader{
+		MaxLineSize: DefaultMaxLineSize,
+		src:         data,
+		fromSrc:     true,
+	}
+}
+
+// Reset переключает Reader на чтение из r, сохраняя буферы и настройки.
+func (r *Reader) Reset(rd io.Reader) {
+	if r.r == nil {
+		r.r = bufio.NewReader(rd)
+	} else {
+		r.r.Reset(rd)
+	}
+	r.src = nil
+	r.fromSrc = false
+	r.line = 0
+	r.data = nil
+	r.err = nil
+	r.skipped = 0
+}
+
+// NextLine переходит к следующей строке. Возвращает false в конце ввода
+// или при ошибке (см. Err). Слишком длинные строки при SkipBad пропускаются,
+// ошибки чтения из источника останавливают чтение всегда.
+func (r *Reader) NextLine() bool {
+	for r.err == nil {
+		err := r.readLine()
+		if err == nil {
+			return true
+		}
+		if err != ErrLineTooLong {
+			r.err = err
+			break
+		}
+		if !r.fail(err) {
+			break
+		}
+	}
+	return false
+}
+
+// Next читает следующую строку и разбирает её в v.
+func (r *Reader) Next(v Unmarshaler) bool {
+	for r.NextLine() {
+		err := v.UnmarshalJSON(r.data)
+		if err == nil {
+			return true
+		}
+		if !r.fail(err) {
+			return false
+		}
+	}
+	return false
+}
+
+// fail обрабатывает ошибку текущей строки и сообщает, можно ли читать дальше.
+func (r *Reader) fail(err error) bool {
+	lineErr := &LineError{Line: r.line, Err: err}
+	if !r.SkipBad {
+		r.err = lineErr
+		return false
+	}
+	r.skipped++
+	if r.OnError != nil {
+		r.OnError(lineErr)
+	}
+	return true
+}
+
+// Bytes - текущая строка без перевода строки.
+func (r *Reader) Bytes() []byte {
+	return r.data
+}
+
+// Line - номер текущей строки, начиная с 1.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Skipped - сколько строк пропущено из-за ошибок при SkipBad.
+func (r *Reader) Skipped() int {
+	return r.skipped
+}
+
+// Err возвращает первую ошибку, остановившую чтение, или nil в конце ввода.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+func (r *Reader) readLine() error {
+	if r.fromSrc {
+		return r.readSrcLine()
+	}
+	line, err := r.r.ReadSlice('\n')
+	if err == io.EOF && len(line) == 0 {
+		return io.EOF
+	}
+	r.line++
+	if err == bufio.ErrBufferFull {
+		return r.readLongLine(line)
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return r.setLine(line)
+}
+
+func (r *Reader) readSrcLine() error {
+	if len(r.src) == 0 {
+		return io.EOF
+	}
+	r.line++
+	end := bytes.IndexByte(r.src, '\n')
+	if end < 0 {
+		end = len(r.src) - 1
+	}
+	line := r.src[:end+1]
+	r.src = r.src[end+1:]
+	return r.setLine(line)
+}
+
+// readLongLine дочитывает строку, не поместившуюся в буфер, копируя её в r.long.
+func (r *Reader) readLongLine(line []byte) error {
+	r.long = append(r.long[:0], line...)
+	for {
+		line, err := r.r.ReadSlice('\n')
+		if r.MaxLineSize <= 0 || len(r.long) <= r.MaxLineSize {
+			r.long = append(r.long, line...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return r.setLine(r.long)
+	}
+}
+
+func (r *Reader) setLine(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	r.data = line
+	if r.MaxLineSize > 0 && len(line) > r.MaxLineSize {
+		r.data = nil
+		return ErrLineTooLong
+	}
+	return nil
+}
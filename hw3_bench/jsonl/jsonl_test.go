@@ -0,0 +1,102 @@
+package jsonl
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	ID int `json:"id"`
+}
+
+func (i *item) UnmarshalJSON(data []byte) error {
+	type plain item
+	return json.Unmarshal(data, (*plain)(i))
+}
+
+func TestReader(t *testing.T) {
+	input := "{\"id\":1}\r\n{\"id\":2}\n{\"id\":3}"
+	for _, r := range []*Reader{NewReader(strings.NewReader(input)), NewReaderBytes([]byte(input))} {
+		var ids, lines []int
+		it := &item{}
+		for r.Next(it) {
+			ids = append(ids, it.ID)
+			lines = append(lines, r.Line())
+		}
+		if err := r.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 3 || ids[2] != 3 || lines[2] != 3 {
+			t.Errorf("unexpected result: ids %v, lines %v", ids, lines)
+		}
+	}
+}
+
+func TestReaderBadLine(t *testing.T) {
+	input := "{\"id\":1}\nnot json\n{\"id\":3}\n"
+
+	r := NewReader(strings.NewReader(input))
+	it := &item{}
+	count := 0
+	for r.Next(it) {
+		count++
+	}
+	lineErr := &LineError{}
+	if !errors.As(r.Err(), &lineErr) || lineErr.Line != 2 || count != 1 {
+		t.Errorf("expected error at line 2 after 1 item, got %v after %d", r.Err(), count)
+	}
+
+	r = NewReader(strings.NewReader(input))
+	r.SkipBad = true
+	var reported []int
+	r.OnError = func(err *LineError) {
+		reported = append(reported, err.Line)
+	}
+	var lines []int
+	for r.Next(it) {
+		lines = append(lines, r.Line())
+	}
+	if r.Err() != nil || len(lines) != 2 || lines[1] != 3 || r.Skipped() != 1 || len(reported) != 1 || reported[0] != 2 {
+		t.Errorf("unexpected skip result: err %v, lines %v, reported %v", r.Err(), lines, reported)
+	}
+}
+
+func TestReaderLongLines(t *testing.T) {
+	long := "{\"id\":5,\"pad\":\"" + strings.Repeat("x", 200) + "\"}"
+	input := long + "\n" + strings.Repeat("y", 1000) + "\n{\"id\":7}\n"
+
+	// строки длиннее буфера, но короче MaxLineSize читаются целиком
+	r := NewReaderSize(strings.NewReader(input), 16)
+	r.MaxLineSize = 500
+	r.SkipBad = true
+	it := &item{}
+	var ids []int
+	for r.Next(it) {
+		ids = append(ids, it.ID)
+	}
+	if r.Err() != nil || len(ids) != 2 || ids[0] != 5 || ids[1] != 7 || r.Skipped() != 1 {
+		t.Errorf("unexpected result: err %v, ids %v, skipped %d", r.Err(), ids, r.Skipped())
+	}
+
+	r = NewReaderSize(strings.NewReader(input), 16)
+	r.MaxLineSize = 500
+	for r.NextLine() {
+	}
+	if !errors.Is(r.Err(), ErrLineTooLong) || r.Line() != 2 {
+		t.Errorf("expected ErrLineTooLong at line 2, got %v at %d", r.Err(), r.Line())
+	}
+}
+
+func TestReaderZeroCopy(t *testing.T) {
+	r := NewReader(strings.NewReader(strings.Repeat("{\"id\":1}\n", 1000)))
+	allocs := testing.AllocsPerRun(500, func() {
+		if !r.NextLine() {
+			t.Fatal("unexpected end of input")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("NextLine allocates: %v allocs", allocs)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "адрес HTTP-сервиса")
+	path := flag.String("data", filePath, "файл с пользователями")
+	checkInterval := flag.Duration("check-interval", time.Second, "как часто проверять файл на изменения, 0 - на каждом запросе")
+	dedup := flag.String("dedup", "", "вместо запуска сервиса записать пользователей без дубликатов в этот файл, отчёт - в stdout")
+	flag.Parse()
+
+	if *dedup != "" {
+		DedupUsers(*path, *dedup, os.Stdout)
+		return
+	}
+
+	srv, err := NewUsersServer(*path)
+	if err != nil {
+		panic(err)
+	}
+	srv.CheckInterval = *checkInterval
+
+	fmt.Println("starting server at", *addr)
+	if err := http.ListenAndServe(*addr, srv.Handler()); err != nil {
+		panic(err)
+	}
+}
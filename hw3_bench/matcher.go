@@ -0,0 +1,155 @@
+package main
+
+// Matcher ищет сразу несколько подстрок за один проход по строке
+// (алгоритм Ахо-Корасик). Автомат строится детерминированным: переход
+// по каждому байту - одно обращение к плоской таблице, без возвратов по
+// суффиксным ссылкам. Чтобы таблица была маленькой, байты, не встречающиеся
+// в шаблонах, сводятся в класс 0, остальные получают по своему классу.
+type Matcher struct {
+	patterns []string
+	classes  [256]uint16
+	nclasses int
+	// next[row+class] - следующее состояние, где row = state*nclasses.
+	// Хранится сразу row<<1, младший бит - есть ли у состояния шаблоны
+	// в out: так на каждый байт нужно одно чтение таблицы без умножения.
+	next []int32
+	// outIDs[outStart[state]:outStart[state+1]] - шаблоны, которые
+	// заканчиваются в состоянии state, включая найденные по суффиксным ссылкам
+	outStart []int32
+	outIDs   []int32
+	// empty - номера пустых шаблонов, они есть в любой строке
+	empty []int32
+}
+
+// NewMatcher строит автомат по шаблонам; номер шаблона - его индекс в patterns.
+func NewMatcher(patterns ...string) *Matcher {
+	m := &Matcher{patterns: patterns, nclasses: 1}
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			if m.classes[p[i]] == 0 {
+				m.classes[p[i]] = uint16(m.nclasses)
+				m.nclasses++
+			}
+		}
+	}
+
+	// бор; -1 - перехода нет
+	next := make([]int32, m.nclasses)
+	for i := range next {
+		next[i] = -1
+	}
+	var outs [][]int32
+	outs = append(outs, nil)
+	for id, p := range patterns {
+		if p == "" {
+			m.empty = append(m.empty, int32(id))
+			continue
+		}
+		state := int32(0)
+		for i := 0; i < len(p); i++ {
+			idx := int(state)*m.nclasses + int(m.classes[p[i]])
+			if next[idx] < 0 {
+				next[idx] = int32(len(outs))
+				outs = append(outs, nil)
+				for c := 0; c < m.nclasses; c++ {
+					next = append(next, -1)
+				}
+			}
+			state = next[idx]
+		}
+		outs[state] = append(outs[state], int32(id))
+	}
+
+	// обход в ширину: суффиксные ссылки и достраивание переходов до автомата
+	fail := make([]int32, len(outs))
+	queue := make([]int32, 0, len(outs))
+	for c := 0; c < m.nclasses; c++ {
+		if s := next[c]; s < 0 {
+			next[c] = 0
+		} else {
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		outs[state] = append(outs[state], outs[fail[state]]...)
+		for c := 0; c < m.nclasses; c++ {
+			idx := int(state)*m.nclasses + c
+			if s := next[idx]; s < 0 {
+				next[idx] = next[int(fail[state])*m.nclasses+c]
+			} else {
+				fail[s] = next[int(fail[state])*m.nclasses+c]
+				queue = append(queue, s)
+			}
+		}
+	}
+	for i, state := range next {
+		next[i] = state * int32(m.nclasses) << 1
+		if len(outs[state]) > 0 {
+			next[i] |= 1
+		}
+	}
+	m.next = next
+	m.outStart = make([]int32, len(outs)+1)
+	for state, ids := range outs {
+		m.outStart[state+1] = m.outStart[state] + int32(len(ids))
+		m.outIDs = append(m.outIDs, ids...)
+	}
+	return m
+}
+
+// Patterns возвращает шаблоны, по которым построен автомат.
+func (m *Matcher) Patterns() []string {
+	return m.patterns
+}
+
+// NewSet возвращает пустое множество номеров шаблонов для Match.
+func (m *Matcher) NewSet() MatchSet {
+	return make(MatchSet, (len(m.patterns)+63)/64)
+}
+
+// Match добавляет в set номера всех шаблонов, встречающихся в s.
+func (m *Matcher) Match(s string, set MatchSet) {
+	for _, id := range m.empty {
+		set.add(int(id))
+	}
+	next, classes := m.next, &m.classes
+	row := int32(0)
+	for i := 0; i < len(s); i++ {
+		v := next[row+int32(classes[s[i]])]
+		row = v >> 1
+		if v&1 != 0 {
+			state := row / int32(m.nclasses)
+			for _, id := range m.outIDs[m.outStart[state]:m.outStart[state+1]] {
+				set.add(int(id))
+			}
+		}
+	}
+}
+
+// MatchSet - битовое множество номеров шаблонов.
+type MatchSet []uint64
+
+func (s MatchSet) add(i int) {
+	s[i/64] |= 1 << uint(i%64)
+}
+
+// Has сообщает, найден ли шаблон i.
+func (s MatchSet) Has(i int) bool {
+	return s[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Reset очищает множество.
+func (s MatchSet) Reset() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// Or добавляет в s все номера из other.
+func (s MatchSet) Or(other MatchSet) {
+	for i := range s {
+		s[i] |= other[i]
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "", "MSIE", "Android", "s", "hers"}
+	m := NewMatcher(patterns...)
+	for _, s := range []string{"", "ushers", "Mozilla/4.0 (compatible; MSIE 7.0)", "Android 4.0 MSIE", "xyz", "hhhis"} {
+		set := m.NewSet()
+		m.Match(s, set)
+		for i, p := range patterns {
+			if set.Has(i) != strings.Contains(s, p) {
+				t.Errorf("%q in %q: got %v", p, s, set.Has(i))
+			}
+		}
+	}
+}
+
+func TestMatcherRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	word := func(max int) string {
+		b := make([]byte, rnd.Intn(max))
+		for i := range b {
+			b[i] = "abc\x00\xff"[rnd.Intn(5)]
+		}
+		return string(b)
+	}
+	for iter := 0; iter < 200; iter++ {
+		patterns := make([]string, 1+rnd.Intn(10))
+		for i := range patterns {
+			patterns[i] = word(5)
+		}
+		m := NewMatcher(patterns...)
+		set := m.NewSet()
+		for j := 0; j < 20; j++ {
+			s := word(30)
+			set.Reset()
+			m.Match(s, set)
+			for i, p := range patterns {
+				if set.Has(i) != strings.Contains(s, p) {
+					t.Fatalf("%q in %q: got %v", p, s, set.Has(i))
+				}
+			}
+		}
+	}
+}
+
+func TestMatcherAllBytes(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	m := NewMatcher(string(all), "\xff\x00")
+	set := m.NewSet()
+	m.Match("x"+string(all)+"\x00", set)
+	if !set.Has(0) || !set.Has(1) {
+		t.Errorf("patterns not found: %b", set)
+	}
+}
+
+// benchmarkPatterns возвращает n шаблонов: Android, MSIE и токены,
+// которые встречаются в data/users.txt, вперемешку с несуществующими.
+func benchmarkPatterns(n int) []string {
+	tokens := []string{"Android", "MSIE", "Chrome/", "Firefox/", "Opera", "Safari/", "Trident/", "iPhone", "Windows NT 6.1", "Linux", "Gecko/", "WebKit", "BlackBerry", "Version/", "Mobile", "Macintosh", "Presto/", "rv:", "Nokia", "SymbianOS"}
+	patterns := make([]string, n)
+	for i := range patterns {
+		if i < len(tokens) {
+			patterns[i] = tokens[i]
+		} else {
+			patterns[i] = fmt.Sprintf("%s-%d", tokens[i%len(tokens)], i)
+		}
+	}
+	return patterns
+}
+
+func benchmarkBrowsers(b *testing.B) []string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var browsers []string
+	in, _ := NewInput(strings.NewReader(string(data)))
+	lines := in.Lines()
+	for u := new(user); lines.Next(u); u = new(user) {
+		browsers = append(browsers, u.Browsers...)
+	}
+	return browsers
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	browsers := benchmarkBrowsers(b)
+	for _, n := range []int{2, 20, 200} {
+		patterns := benchmarkPatterns(n)
+		b.Run(fmt.Sprintf("contains/%d", n), func(b *testing.B) {
+			found := make([]bool, n)
+			for i := 0; i < b.N; i++ {
+				for _, browser := range browsers {
+					for j, p := range patterns {
+						found[j] = strings.Contains(browser, p)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("matcher/%d", n), func(b *testing.B) {
+			m := NewMatcher(patterns...)
+			set := m.NewSet()
+			for i := 0; i < b.N; i++ {
+				for _, browser := range browsers {
+					set.Reset()
+					m.Match(browser, set)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// OutputFormat - формат вывода найденных пользователей.
+type OutputFormat int
+
+const (
+	// FormatText - исходный формат FastSearch:
+	//	found users:
+	//	[id] name <email [at] domain>
+	//
+	//	Total unique browsers N
+	FormatText OutputFormat = iota
+	// FormatCSV - заголовок id,name,email и по строке на пользователя.
+	// Итоговое количество браузеров не выводится.
+	FormatCSV
+	// FormatJSONLines - {"id":..,"name":..,"email":..} на пользователя и
+	// последней строкой {"total_unique_browsers":N}.
+	FormatJSONLines
+)
+
+type OutputOptions struct {
+	Format OutputFormat
+	// RawEmail отключает замену @ на " [at] ".
+	RawEmail bool
+}
+
+// resultWriter пишет результаты поиска, не аллоцируя память на каждого
+// пользователя: строка собирается в переиспользуемом буфере.
+type resultWriter struct {
+	w    *bufio.Writer
+	opts OutputOptions
+	buf  []byte
+}
+
+func newResultWriter(out io.Writer, opts OutputOptions) *resultWriter {
+	return &resultWriter{
+		w:    bufio.NewWriter(out),
+		opts: opts,
+		buf:  make([]byte, 0, 256),
+	}
+}
+
+func (w *resultWriter) begin() {
+	switch w.opts.Format {
+	case FormatText:
+		w.w.WriteString("found users:\n")
+	case FormatCSV:
+		w.w.WriteString("id,name,email\n")
+	}
+}
+
+func (w *resultWriter) user(id int, name, email string) {
+	b := w.buf[:0]
+	switch w.opts.Format {
+	case FormatText:
+		b = append(b, '[')
+		b = strconv.AppendInt(b, int64(id), 10)
+		b = append(b, "] "...)
+		b = append(b, name...)
+		b = append(b, " <"...)
+		b = w.appendEmail(b, email)
+		b = append(b, ">\n"...)
+	case FormatCSV:
+		b = strconv.AppendInt(b, int64(id), 10)
+		b = append(b, ',')
+		b = appendCSVField(b, name, false)
+		b = append(b, ',')
+		b = appendCSVField(b, email, !w.opts.RawEmail)
+		b = append(b, '\n')
+	case FormatJSONLines:
+		b = append(b, `{"id":`...)
+		b = strconv.AppendInt(b, int64(id), 10)
+		b = append(b, `,"name":`...)
+		b = appendJSONString(b, name)
+		b = append(b, `,"email":`...)
+		b = appendJSONEmail(b, email, !w.opts.RawEmail)
+		b = append(b, "}\n"...)
+	}
+	w.buf = b
+	w.w.Write(b)
+}
+
+func (w *resultWriter) end(uniqueBrowsers int) error {
+	b := w.buf[:0]
+	switch w.opts.Format {
+	case FormatText:
+		b = append(b, "\nTotal unique browsers "...)
+		b = strconv.AppendInt(b, int64(uniqueBrowsers), 10)
+		b = append(b, '\n')
+	case FormatJSONLines:
+		b = append(b, `{"total_unique_browsers":`...)
+		b = strconv.AppendInt(b, int64(uniqueBrowsers), 10)
+		b = append(b, "}\n"...)
+	}
+	w.buf = b
+	w.w.Write(b)
+	return w.w.Flush()
+}
+
+func (w *resultWriter) appendEmail(b []byte, email string) []byte {
+	if w.opts.RawEmail {
+		return append(b, email...)
+	}
+	for i := 0; i < len(email); i++ {
+		if email[i] == '@' {
+			b = append(b, " [at] "...)
+		} else {
+			b = append(b, email[i])
+		}
+	}
+	return b
+}
+
+// appendCSVField дописывает поле CSV, при необходимости в кавычках.
+// obfuscate заменяет @ на " [at] ".
+func appendCSVField(b []byte, field string, obfuscate bool) []byte {
+	quote := len(field) > 0 && (field[0] == ' ' || field[0] == '\t' || (obfuscate && field[0] == '@'))
+	for i := 0; i < len(field) && !quote; i++ {
+		switch field[i] {
+		case ',', '"', '\n', '\r':
+			quote = true
+		}
+	}
+	if quote {
+		b = append(b, '"')
+	}
+	for i := 0; i < len(field); i++ {
+		switch {
+		case obfuscate && field[i] == '@':
+			b = append(b, " [at] "...)
+		case field[i] == '"':
+			b = append(b, '"', '"')
+		default:
+			b = append(b, field[i])
+		}
+	}
+	if quote {
+		b = append(b, '"')
+	}
+	return b
+}
+
+func appendJSONEmail(b []byte, email string, obfuscate bool) []byte {
+	if !obfuscate {
+		return appendJSONString(b, email)
+	}
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(email); i++ {
+		if email[i] == '@' {
+			b = appendJSONStringBody(b, email[start:i])
+			b = append(b, " [at] "...)
+			start = i + 1
+		}
+	}
+	b = appendJSONStringBody(b, email[start:])
+	return append(b, '"')
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	b = appendJSONStringBody(b, s)
+	return append(b, '"')
+}
+
+const hexDigits = "0123456789abcdef"
+
+func appendJSONStringBody(b []byte, s string) []byte {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return b
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOutputCSV(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := newResultWriter(out, OutputOptions{Format: FormatCSV})
+	w.begin()
+	w.user(1, "Sharon Crawford", "Jonathan@Muxo.edu")
+	w.user(2, `Bob "the, builder"`, "@odd")
+	w.end(10)
+
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"id", "name", "email"},
+		{"1", "Sharon Crawford", "Jonathan [at] Muxo.edu"},
+		{"2", `Bob "the, builder"`, " [at] odd"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("unexpected records %q", records)
+	}
+	for i := range expected {
+		if strings.Join(records[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("record %d: got %q, expected %q", i, records[i], expected[i])
+		}
+	}
+}
+
+func TestOutputJSONLines(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := newResultWriter(out, OutputOptions{Format: FormatJSONLines, RawEmail: true})
+	w.begin()
+	w.user(3, "Анна \"Ann\"\t\x01", "ann@example.com")
+	w.end(7)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	rec := struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != 3 || rec.Name != "Анна \"Ann\"\t\x01" || rec.Email != "ann@example.com" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if lines[1] != `{"total_unique_browsers":7}` {
+		t.Errorf("unexpected summary %s", lines[1])
+	}
+}
+
+func TestOutputTextMatchesSlow(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+	out := new(bytes.Buffer)
+	QuerySearchFormat(out, androidAndMSIE, OutputOptions{Format: FormatText})
+	if out.String() != slowOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), slowOut.String())
+	}
+
+	out.Reset()
+	QuerySearchFormat(out, androidAndMSIE, OutputOptions{RawEmail: true})
+	if strings.Contains(out.String(), " [at] ") || !strings.Contains(out.String(), "@") {
+		t.Errorf("email obfuscated with RawEmail")
+	}
+}
+
+func TestOutputNoAllocs(t *testing.T) {
+	for _, format := range []OutputFormat{FormatText, FormatCSV, FormatJSONLines} {
+		w := newResultWriter(ioutil.Discard, OutputOptions{Format: format})
+		allocs := testing.AllocsPerRun(100, func() {
+			w.user(123, "Sharon \"Crawford\"", "Jonathan@Muxo.edu")
+		})
+		if allocs != 0 {
+			t.Errorf("format %d: %v allocs per user", format, allocs)
+		}
+	}
+}
+
+func BenchmarkFastCSV(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		QuerySearchFormat(ioutil.Discard, androidAndMSIE, OutputOptions{Format: FormatCSV})
+	}
+}
+
+func BenchmarkFastJSONLines(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		QuerySearchFormat(ioutil.Discard, androidAndMSIE, OutputOptions{Format: FormatJSONLines})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"coursera/hw3_bench/jsonl"
+)
+
+// Параллельный поиск для больших файлов: файл режется на куски по границам
+// строк, каждый кусок разбирается в своей горутине, а результаты склеиваются
+// в исходном порядке. Номер строки [id] считается как сумма количества строк
+// в предыдущих кусках плюс номер строки внутри куска.
+
+var lineReaderPool = sync.Pool{
+	New: func() interface{} {
+		return jsonl.NewReaderSize(nil, 64*1024)
+	},
+}
+
+type chunkMatch struct {
+	line  int
+	name  string
+	email string
+}
+
+type chunkResult struct {
+	lines   int
+	matches []chunkMatch
+	seen    map[string]struct{}
+}
+
+// ParallelSearch работает как QuerySearchFormat, но разбирает файл в workers
+// горутин. workers <= 0 означает runtime.GOMAXPROCS(0).
+func ParallelSearch(out io.Writer, q *Query, workers int, opts OutputOptions) {
+	parallelSearchFile(out, filePath, q, workers, opts)
+}
+
+// parallelSearchFile - ParallelSearch по файлу path.
+func parallelSearchFile(out io.Writer, path string, q *Query, workers int, opts OutputOptions) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+	bounds, err := chunkBounds(file, info.Size(), workers)
+	if err != nil {
+		panic(err)
+	}
+
+	results := make([]chunkResult, len(bounds)-1)
+	errs := make([]error, len(bounds)-1)
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			section := io.NewSectionReader(file, bounds[i], bounds[i+1]-bounds[i])
+			results[i], errs[i] = searchChunk(section, q)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	seenBrowsers := make(map[string]struct{})
+	w := newResultWriter(out, opts)
+
+	w.begin()
+	base := 0
+	for _, res := range results {
+		for _, m := range res.matches {
+			w.user(base+m.line, m.name, m.email)
+		}
+		base += res.lines
+		for browser := range res.seen {
+			seenBrowsers[browser] = struct{}{}
+		}
+	}
+	if err := w.end(len(seenBrowsers)); err != nil {
+		panic(err)
+	}
+}
+
+// chunkBounds делит [0, size) на n кусков, сдвигая каждую границу
+// на начало следующей строки. Возвращает границы кусков, включая 0 и size.
+func chunkBounds(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := []int64{0}
+	buf := make([]byte, 4096)
+	for i := 1; i < n; i++ {
+		offset := size * int64(i) / int64(n)
+		if offset <= bounds[len(bounds)-1] {
+			continue
+		}
+		for offset < size {
+			k, err := r.ReadAt(buf, offset)
+			if idx := bytes.IndexByte(buf[:k], '\n'); idx >= 0 {
+				offset += int64(idx) + 1
+				break
+			}
+			offset += int64(k)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if offset >= size {
+			break
+		}
+		if offset > bounds[len(bounds)-1] {
+			bounds = append(bounds, offset)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+func searchChunk(r io.Reader, q *Query) (chunkResult, error) {
+	res := chunkResult{seen: make(map[string]struct{})}
+
+	lines := lineReaderPool.Get().(*jsonl.Reader)
+	defer lineReaderPool.Put(lines)
+	lines.Reset(r)
+
+	track := func(browser string) {
+		res.seen[browser] = struct{}{}
+	}
+	scratch := q.newScratch()
+
+	u := &user{}
+	target := q.lineTarget(u)
+	for ; ; res.lines++ {
+		*u = user{Browsers: u.Browsers[:0]}
+		if !lines.Next(target) {
+			break
+		}
+		if q.matchTracked(u, scratch, track) {
+			res.matches = append(res.matches, chunkMatch{line: res.lines, name: u.Name, email: u.Email})
+		}
+	}
+	return res, lines.Err()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParallelSearch(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	for _, workers := range []int{1, 2, 3, 7, 64, 5000, 0} {
+		out := new(bytes.Buffer)
+		ParallelSearch(out, androidAndMSIE, workers, OutputOptions{})
+		if out.String() != fastOut.String() {
+			t.Errorf("workers %d: results not match\nGot:\n%v\nExpected:\n%v", workers, out.String(), fastOut.String())
+		}
+	}
+}
+
+func TestChunkBounds(t *testing.T) {
+	data := "a\nbb\nccc\ndddd\n"
+	for n := 1; n <= 20; n++ {
+		bounds, err := chunkBounds(strings.NewReader(data), int64(len(data)), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bounds[0] != 0 || bounds[len(bounds)-1] != int64(len(data)) {
+			t.Errorf("n %d: bad bounds %v", n, bounds)
+		}
+		for i := 1; i < len(bounds)-1; i++ {
+			if bounds[i] <= bounds[i-1] || data[bounds[i]-1] != '\n' {
+				t.Errorf("n %d: bound %d not at line start: %v", n, bounds[i], bounds)
+			}
+		}
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ParallelSearch(ioutil.Discard, androidAndMSIE, 0, OutputOptions{})
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Язык запросов для поиска по пользователям:
+//
+//	browsers ~ "Android" AND browsers ~ "MSIE" AND country = "Kenya"
+//
+// Поля: name, email, country и browsers. Операторы: = (равно), != (не равно),
+// ~ (содержит подстроку), !~ (не содержит). Для browsers условие выполняется,
+// если ему удовлетворяет хотя бы один браузер пользователя. Условия
+// объединяются через AND, OR, NOT и скобки; AND связывает сильнее, чем OR.
+//
+// Запрос компилируется один раз в дерево, проверка которого не аллоцирует память.
+// Если условий browsers ~ много, все их подстроки ищутся в браузере за один
+// проход автоматом Matcher, а не отдельным strings.Contains на каждое.
+
+// AndroidAndMSIEQuery - то, что изначально искал FastSearch.
+const AndroidAndMSIEQuery = `browsers ~ "Android" AND browsers ~ "MSIE"`
+
+type Query struct {
+	src  string
+	root queryNode
+	// условия на browsers без отрицания - браузеры, попавшие под них,
+	// учитываются в "Total unique browsers"
+	browserTerms []*queryTerm
+	// containsTerms - все условия browsers ~ и browsers !~; при
+	// matcherMinPatterns и больше их ищет matcher
+	containsTerms []*queryTerm
+	matcher       *Matcher
+	// scratches - свободные буферы matcher'а для Match и TracksBrowser;
+	// их не больше, чем было одновременных вызовов
+	scratchMu sync.Mutex
+	scratches []*queryScratch
+	// usesCountry - есть ли условия на country; без них поле можно не разбирать
+	usesCountry bool
+}
+
+// matcherMinPatterns - с какого числа подстрок включается Matcher.
+// Если проверять все подстроки (BenchmarkMatcher), Contains быстрее только
+// на 2-3 подстроках, но в запросах OR и AND прекращают проверку на первом
+// решающем условии. На всём поиске (BenchmarkSearchPatterns, медиана из 6
+// запусков, мс на поиск, Contains/Matcher): запрос FastSearch - 1.8/2.5,
+// 2 подстроки - 2.3/3.2, 32 - 3.9/5.2, 64 - 4.5/3.9, 200 - 7.5/4.7.
+// Поэтому FastSearch обходится без Matcher'а, а включается он с 64.
+const matcherMinPatterns = 64
+
+// CompileQuery разбирает запрос.
+func CompileQuery(src string) (*Query, error) {
+	p := &queryParser{lex: queryLexer{src: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	q := &Query{src: src}
+	root, err := p.parseOr(q, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	q.root = root
+	if len(q.containsTerms) >= matcherMinPatterns {
+		q.buildMatcher()
+	}
+	return q, nil
+}
+
+func (q *Query) buildMatcher() {
+	patterns := make([]string, len(q.containsTerms))
+	for i, term := range q.containsTerms {
+		patterns[i], term.pattern = term.value, i
+	}
+	q.matcher = NewMatcher(patterns...)
+}
+
+// MustCompileQuery как CompileQuery, но паникует при ошибке.
+func MustCompileQuery(src string) *Query {
+	q, err := CompileQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// Match проверяет, подходит ли пользователь под запрос.
+func (q *Query) Match(u *user) bool {
+	sc := q.getScratch()
+	defer q.putScratch(sc)
+	return q.matchTracked(u, sc, nil)
+}
+
+// TracksBrowser сообщает, упомянут ли браузер в условиях запроса на browsers.
+func (q *Query) TracksBrowser(browser string) bool {
+	sc := q.getScratch()
+	defer q.putScratch(sc)
+	return q.trackBrowser(browser, sc)
+}
+
+// queryScratch - буферы matcher'а для проверок в одной горутине.
+type queryScratch struct {
+	user, browser MatchSet
+}
+
+// newScratch возвращает nil, если запрос обходится без matcher'а.
+func (q *Query) newScratch() *queryScratch {
+	if q.matcher == nil {
+		return nil
+	}
+	return &queryScratch{user: q.matcher.NewSet(), browser: q.matcher.NewSet()}
+}
+
+// getScratch как newScratch, но переиспользует буферы, возвращённые
+// putScratch, чтобы Match и TracksBrowser не аллоцировали на каждом вызове.
+func (q *Query) getScratch() *queryScratch {
+	if q.matcher == nil {
+		return nil
+	}
+	q.scratchMu.Lock()
+	defer q.scratchMu.Unlock()
+	if n := len(q.scratches); n > 0 {
+		sc := q.scratches[n-1]
+		q.scratches = q.scratches[:n-1]
+		return sc
+	}
+	return q.newScratch()
+}
+
+func (q *Query) putScratch(sc *queryScratch) {
+	if sc == nil {
+		return
+	}
+	q.scratchMu.Lock()
+	q.scratches = append(q.scratches, sc)
+	q.scratchMu.Unlock()
+}
+
+// matchTracked работает как Match и вдобавок вызывает track для каждого
+// браузера u, для которого TracksBrowser вернул бы true. С matcher'ом
+// каждый браузер просматривается ровно один раз.
+func (q *Query) matchTracked(u *user, sc *queryScratch, track func(browser string)) bool {
+	if sc == nil {
+		if track != nil {
+			for _, browser := range u.Browsers {
+				if q.tracks(browser, nil) {
+					track(browser)
+				}
+			}
+		}
+		return q.root.match(u, nil)
+	}
+
+	sc.user.Reset()
+	for _, browser := range u.Browsers {
+		sc.browser.Reset()
+		q.matcher.Match(browser, sc.browser)
+		sc.user.Or(sc.browser)
+		if track != nil && q.tracks(browser, sc.browser) {
+			track(browser)
+		}
+	}
+	return q.root.match(u, sc.user)
+}
+
+func (q *Query) trackBrowser(browser string, sc *queryScratch) bool {
+	if sc == nil {
+		return q.tracks(browser, nil)
+	}
+	sc.browser.Reset()
+	q.matcher.Match(browser, sc.browser)
+	return q.tracks(browser, sc.browser)
+}
+
+// tracks проверяет условия на browsers; hits - что нашёл в browser matcher.
+func (q *Query) tracks(browser string, hits MatchSet) bool {
+	for _, term := range q.browserTerms {
+		if term.matchBrowser(browser, hits) {
+			return true
+		}
+	}
+	return false
+}
+
+// hits - шаблоны matcher'а, найденные хотя бы в одном браузере
+// пользователя, nil - matcher не используется.
+type queryNode interface {
+	match(u *user, hits MatchSet) bool
+}
+
+type queryField int
+
+const (
+	fieldName queryField = iota
+	fieldEmail
+	fieldCountry
+	fieldBrowsers
+)
+
+var queryFields = map[string]queryField{
+	"name":     fieldName,
+	"email":    fieldEmail,
+	"country":  fieldCountry,
+	"browsers": fieldBrowsers,
+}
+
+type queryOp int
+
+const (
+	opEqual queryOp = iota
+	opContains
+)
+
+type queryTerm struct {
+	field  queryField
+	op     queryOp
+	negate bool
+	value  string
+	// pattern - номер value в Query.matcher, -1 - ищется strings.Contains
+	pattern int
+}
+
+func (t *queryTerm) matchString(s string) bool {
+	if t.op == opEqual {
+		return s == t.value
+	}
+	return strings.Contains(s, t.value)
+}
+
+// matchBrowser проверяет условие на одном браузере, без учёта negate.
+func (t *queryTerm) matchBrowser(browser string, hits MatchSet) bool {
+	if t.pattern >= 0 && hits != nil {
+		return hits.Has(t.pattern)
+	}
+	return t.matchString(browser)
+}
+
+func (t *queryTerm) match(u *user, hits MatchSet) bool {
+	var res bool
+	switch t.field {
+	case fieldName:
+		res = t.matchString(u.Name)
+	case fieldEmail:
+		res = t.matchString(u.Email)
+	case fieldCountry:
+		res = t.matchString(u.Country)
+	case fieldBrowsers:
+		if t.pattern >= 0 && hits != nil {
+			res = hits.Has(t.pattern)
+			break
+		}
+		for _, browser := range u.Browsers {
+			if t.matchString(browser) {
+				res = true
+				break
+			}
+		}
+	}
+	return res != t.negate
+}
+
+type queryAnd []queryNode
+
+func (n queryAnd) match(u *user, hits MatchSet) bool {
+	for _, child := range n {
+		if !child.match(u, hits) {
+			return false
+		}
+	}
+	return true
+}
+
+type queryOr []queryNode
+
+func (n queryOr) match(u *user, hits MatchSet) bool {
+	for _, child := range n {
+		if child.match(u, hits) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryNot struct {
+	child queryNode
+}
+
+func (n queryNot) match(u *user, hits MatchSet) bool {
+	return !n.child.match(u, hits)
+}
+
+type queryParser struct {
+	lex queryLexer
+	tok queryToken
+}
+
+func (p *queryParser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query %q at %d: %s", p.lex.src, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// parseOr := parseAnd (OR parseAnd)*
+// negated - находимся ли под нечётным числом NOT, чтобы не считать
+// такие условия на browsers в TracksBrowser.
+func (p *queryParser) parseOr(q *Query, negated bool) (queryNode, error) {
+	node, err := p.parseAnd(q, negated)
+	if err != nil {
+		return nil, err
+	}
+	or := queryOr{node}
+	for p.tok.kind == tokOr {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseAnd(q, negated)
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+// parseAnd := parseUnary (AND parseUnary)*
+func (p *queryParser) parseAnd(q *Query, negated bool) (queryNode, error) {
+	node, err := p.parseUnary(q, negated)
+	if err != nil {
+		return nil, err
+	}
+	and := queryAnd{node}
+	for p.tok.kind == tokAnd {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseUnary(q, negated)
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, node)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+// parseUnary := NOT parseUnary | ( parseOr ) | field op "value"
+func (p *queryParser) parseUnary(q *Query, negated bool) (queryNode, error) {
+	switch p.tok.kind {
+	case tokNot:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseUnary(q, !negated)
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node}, nil
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr(q, negated)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ), got %s", p.tok)
+		}
+		return node, p.next()
+	case tokIdent:
+	default:
+		return nil, p.errorf("expected field, got %s", p.tok)
+	}
+
+	field, ok := queryFields[strings.ToLower(p.tok.text)]
+	if !ok {
+		return nil, p.errorf("unknown field %s", p.tok.text)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	term := &queryTerm{field: field, pattern: -1}
+	switch p.tok.kind {
+	case tokEqual:
+		term.op = opEqual
+	case tokNotEqual:
+		term.op, term.negate = opEqual, true
+	case tokContains:
+		term.op = opContains
+	case tokNotContains:
+		term.op, term.negate = opContains, true
+	default:
+		return nil, p.errorf("expected operator, got %s", p.tok)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokString {
+		return nil, p.errorf("expected string, got %s", p.tok)
+	}
+	term.value = p.tok.text
+	if field == fieldCountry {
+		q.usesCountry = true
+	}
+	if field == fieldBrowsers && term.negate == negated {
+		q.browserTerms = append(q.browserTerms, term)
+	}
+	if field == fieldBrowsers && term.op == opContains {
+		q.containsTerms = append(q.containsTerms, term)
+	}
+	return term, p.next()
+}
+
+type queryTokenKind int
+
+const (
+	tokEOF queryTokenKind = iota
+	tokIdent
+	tokString
+	tokEqual
+	tokNotEqual
+	tokContains
+	tokNotContains
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return t.text
+}
+
+type queryLexer struct {
+	src string
+	pos int
+}
+
+func (l *queryLexer) next() (queryToken, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return queryToken{kind: tokEOF, pos: start}, nil
+	}
+
+	simple := func(kind queryTokenKind, n int) (queryToken, error) {
+		l.pos += n
+		return queryToken{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	switch c := l.src[l.pos]; {
+	case c == '(':
+		return simple(tokLParen, 1)
+	case c == ')':
+		return simple(tokRParen, 1)
+	case c == '=':
+		return simple(tokEqual, 1)
+	case c == '~':
+		return simple(tokContains, 1)
+	case c == '!' && strings.HasPrefix(l.src[l.pos:], "!="):
+		return simple(tokNotEqual, 2)
+	case c == '!' && strings.HasPrefix(l.src[l.pos:], "!~"):
+		return simple(tokNotContains, 2)
+	case c == '"':
+		return l.lexString()
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		tok := queryToken{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+		switch strings.ToUpper(tok.text) {
+		case "AND":
+			tok.kind = tokAnd
+		case "OR":
+			tok.kind = tokOr
+		case "NOT":
+			tok.kind = tokNot
+		}
+		return tok, nil
+	}
+	return queryToken{}, fmt.Errorf("query %q at %d: unexpected character %q", l.src, start, l.src[start])
+}
+
+func (l *queryLexer) lexString() (queryToken, error) {
+	start := l.pos
+	l.pos++
+	res := strings.Builder{}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return queryToken{kind: tokString, text: res.String(), pos: start}, nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				break
+			}
+			l.pos++
+			c = l.src[l.pos]
+		}
+		res.WriteByte(c)
+		l.pos++
+	}
+	return queryToken{}, fmt.Errorf("query %q at %d: unterminated string", l.src, start)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	u := &user{
+		Name:     "Sharon Crawford",
+		Email:    "JonathanMorris@Muxo.edu",
+		Country:  "Kenya",
+		Browsers: []string{"Mozilla/5.0 (Android; Linux armv7l)", "Mozilla/4.0 (compatible; MSIE 7.0)"},
+	}
+	cases := []struct {
+		query string
+		match bool
+	}{
+		{AndroidAndMSIEQuery, true},
+		{`browsers ~ "Android" AND browsers ~ "MSIE" AND country = "Kenya"`, true},
+		{`browsers ~ "Android" AND country = "Malta"`, false},
+		{`country = "Malta" OR name ~ "Sharon"`, true},
+		{`NOT (country = "Malta" OR country = "Kenya")`, false},
+		{`browsers !~ "Chrome" and email != "x"`, true},
+		{`browsers = "Mozilla/4.0 (compatible; MSIE 7.0)"`, true},
+		{`name = "Sharon \"Crawford\""`, false},
+		{`country = "Malta" OR country = "Kenya" AND name ~ "Bob"`, false},
+	}
+	for _, c := range cases {
+		q, err := CompileQuery(c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if q.Match(u) != c.match {
+			t.Errorf("%s: expected match %v", c.query, c.match)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`browsers`,
+		`browsers ~`,
+		`browsers ~ Android`,
+		`browsers ~ "Android`,
+		`phone = "1"`,
+		`(name = "a"`,
+		`name = "a" name = "b"`,
+		`name > "a"`,
+	} {
+		if _, err := CompileQuery(src); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+}
+
+func TestQueryTracksBrowser(t *testing.T) {
+	q := MustCompileQuery(`browsers ~ "Android" AND NOT browsers ~ "MSIE" AND NOT browsers !~ "Opera"`)
+	for browser, tracked := range map[string]bool{
+		"Android 4.0":  true,
+		"MSIE 7.0":     false,
+		"Opera/9.80":   true,
+		"Chrome/41.0.": false,
+	} {
+		if q.TracksBrowser(browser) != tracked {
+			t.Errorf("%s: expected tracked %v", browser, tracked)
+		}
+	}
+}
+
+func TestQueryMatchNoAllocs(t *testing.T) {
+	u := &user{Country: "Kenya", Browsers: []string{"Android", "Opera", "MSIE"}}
+	for _, q := range []*Query{
+		MustCompileQuery(`browsers ~ "Android" AND browsers ~ "MSIE" OR NOT country = "Kenya"`),
+		MustCompileQuery(patternsQuery(matcherMinPatterns, false).String()),
+	} {
+		allocs := testing.AllocsPerRun(100, func() {
+			q.Match(u)
+			q.TracksBrowser("Android")
+		})
+		if allocs != 0 {
+			t.Errorf("matcher %v: Match allocates: %v allocs", q.matcher != nil, allocs)
+		}
+	}
+}
+
+func TestQuerySearchCountry(t *testing.T) {
+	out := new(bytes.Buffer)
+	QuerySearch(out, MustCompileQuery(`country = "Kenya"`))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// заголовок, 5 пользователей, пустая строка, итог
+	if len(lines) != 8 || lines[0] != "found users:" || lines[7] != "Total unique browsers 0" {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestQueryLineTarget(t *testing.T) {
+	line := []byte(`{"browsers":["Opera"],"country":"Kenya","email":"bob@muxo.edu","name":"Bob"}`)
+	for src, country := range map[string]string{
+		`browsers ~ "Opera"`: "",
+		`country != "Malta"`: "Kenya",
+	} {
+		u := &user{}
+		if err := MustCompileQuery(src).lineTarget(u).UnmarshalJSON(line); err != nil {
+			t.Fatal(err)
+		}
+		if u.Name != "Bob" || u.Country != country {
+			t.Errorf("%s: unexpected user %+v", src, u)
+		}
+	}
+}
+
+func BenchmarkQuerySearch(b *testing.B) {
+	q := MustCompileQuery(`browsers ~ "Android" AND browsers ~ "MSIE" AND country = "Kenya"`)
+	for i := 0; i < b.N; i++ {
+		QuerySearch(ioutil.Discard, q)
+	}
+}
+
+// patternsQuery - browsers ~ "p1" OR ... по n шаблонам из benchmarkPatterns,
+// с matcher'ом или без него независимо от matcherMinPatterns.
+func patternsQuery(n int, matcher bool) *Query {
+	terms := make([]string, n)
+	for i, p := range benchmarkPatterns(n) {
+		terms[i] = `browsers ~ "` + p + `"`
+	}
+	q := MustCompileQuery(strings.Join(terms, " OR "))
+	if matcher {
+		q.buildMatcher()
+	} else {
+		q.matcher = nil
+	}
+	return q
+}
+
+func TestQueryMatcher(t *testing.T) {
+	for _, src := range []string{
+		patternsQuery(40, false).String(),
+		`browsers ~ "Android" AND browsers !~ "Chrome/" AND NOT (browsers ~ "Firefox/" OR browsers ~ "Opera" OR browsers ~ "Safari/") AND browsers ~ "Linux" AND browsers ~ "" AND (browsers ~ "U;" OR browsers ~ "en-" OR browsers ~ "Build/" OR browsers = "x")`,
+	} {
+		q := MustCompileQuery(src)
+		q.buildMatcher()
+		plain := MustCompileQuery(src)
+		plain.matcher = nil
+
+		expected := new(bytes.Buffer)
+		QuerySearch(expected, plain)
+		got := new(bytes.Buffer)
+		QuerySearch(got, q)
+		if got.String() != expected.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", src, got, expected)
+		}
+		parallel := new(bytes.Buffer)
+		ParallelSearch(parallel, q, 4, OutputOptions{})
+		if parallel.String() != expected.String() {
+			t.Errorf("%s: parallel results not match", src)
+		}
+	}
+	if MustCompileQuery(AndroidAndMSIEQuery).matcher != nil {
+		t.Errorf("matcher used for 2 patterns")
+	}
+	if MustCompileQuery(patternsQuery(matcherMinPatterns, false).String()).matcher == nil {
+		t.Errorf("matcher not used for %d patterns", matcherMinPatterns)
+	}
+}
+
+// BenchmarkSearchPatterns сравнивает Contains и Matcher на всём поиске:
+// на запросе FastSearch и на OR из n подстрок. По нему выбран matcherMinPatterns.
+func BenchmarkSearchPatterns(b *testing.B) {
+	for _, n := range []int{0, 2, 8, 16, 32, 64, 200} {
+		for _, matcher := range []bool{false, true} {
+			var q *Query
+			if n == 0 {
+				q = MustCompileQuery(AndroidAndMSIEQuery)
+				if matcher {
+					q.buildMatcher()
+				}
+			} else {
+				q = patternsQuery(n, matcher)
+			}
+			name := "contains"
+			if matcher {
+				name = "matcher"
+			}
+			if n == 0 {
+				name += "/fast"
+			} else {
+				name += fmt.Sprintf("/%d", n)
+			}
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					QuerySearch(ioutil.Discard, q)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTP-сервис поиска по пользователям:
+//
+//	GET /users?browser=Android&browser=MSIE&offset=0&limit=20
+//
+// Несколько browser объединяются через AND, как в AndroidAndMSIEQuery.
+// Данные держатся в памяти в виде Index и перестраиваются, когда у файла
+// меняется размер или mtime; перестраиваются в фоне, не задерживая
+// запросы. Профилировщик доступен по /debug/pprof/.
+
+const (
+	defaultUsersLimit = 20
+	maxUsersLimit     = 1000
+)
+
+type UsersServer struct {
+	Path string
+	// CheckInterval - как часто проверять файл на изменения, 0 - на каждом запросе.
+	CheckInterval time.Duration
+
+	idx atomic.Value // *Index
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	reloading bool
+	reloads   sync.WaitGroup // идущие фоновые перечитывания
+}
+
+// NewUsersServer загружает path в память; без данных сервис не стартует.
+func NewUsersServer(path string) (*UsersServer, error) {
+	idx, err := BuildIndexFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &UsersServer{Path: path, CheckInterval: time.Second, checkedAt: time.Now()}
+	s.idx.Store(idx)
+	return s, nil
+}
+
+// Handler возвращает обработчик /users и /debug/pprof/.
+func (s *UsersServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", s.handleUsers)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// index возвращает текущие данные и, если пора, запускает проверку файла
+// в фоне. Запрос перечитывания не ждёт: пока оно идёт, все отвечают по
+// старым данным. Если файл не разбирается (например, его ещё пишут),
+// старые данные остаются.
+func (s *UsersServer) index() *Index {
+	idx := s.idx.Load().(*Index)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reloading || time.Since(s.checkedAt) < s.CheckInterval {
+		return idx
+	}
+	s.reloading = true
+	s.reloads.Add(1)
+	go s.reload(idx)
+	return idx
+}
+
+// reload перестраивает индекс, если файл изменился после построения idx.
+func (s *UsersServer) reload(idx *Index) {
+	defer s.reloads.Done()
+	defer func() {
+		s.mu.Lock()
+		s.reloading, s.checkedAt = false, time.Now()
+		s.mu.Unlock()
+	}()
+
+	fresh, err := idx.Fresh(s.Path)
+	if err == nil && !fresh {
+		var reloaded *Index
+		if reloaded, err = BuildIndexFile(s.Path); err == nil {
+			s.idx.Store(reloaded)
+		}
+	}
+	if err != nil {
+		log.Printf("users: reload %s: %v", s.Path, err)
+	}
+}
+
+type usersResponse struct {
+	Total          int          `json:"total"`
+	Offset         int          `json:"offset"`
+	Limit          int          `json:"limit"`
+	UniqueBrowsers int          `json:"unique_browsers"`
+	Users          []userResult `json:"users"`
+}
+
+type userResult struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (s *UsersServer) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	params := r.URL.Query()
+	offset, ok := intParam(params.Get("offset"), 0)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "bad offset")
+		return
+	}
+	limit, ok := intParam(params.Get("limit"), defaultUsersLimit)
+	if !ok || limit == 0 || limit > maxUsersLimit {
+		writeJSONError(w, http.StatusBadRequest, "bad limit")
+		return
+	}
+	q, err := browsersQuery(params["browser"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	idx := s.index()
+	resp := usersResponse{
+		Offset:         offset,
+		Limit:          limit,
+		UniqueBrowsers: idx.UniqueBrowsers(q),
+		Users:          []userResult{},
+	}
+	idx.Each(q, func(id int, u *user) {
+		if resp.Total >= offset && len(resp.Users) < limit {
+			resp.Users = append(resp.Users, userResult{ID: id, Name: u.Name, Email: u.Email})
+		}
+		resp.Total++
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// browsersQuery собирает запрос browsers ~ "a" AND browsers ~ "b" ...;
+// без браузеров подходят все пользователи.
+func browsersQuery(browsers []string) (*Query, error) {
+	if len(browsers) == 0 {
+		// пустое AND выполняется для всех
+		return &Query{root: queryAnd{}}, nil
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	terms := make([]string, len(browsers))
+	for i, browser := range browsers {
+		terms[i] = `browsers ~ "` + escaper.Replace(browser) + `"`
+	}
+	return CompileQuery(strings.Join(terms, " AND "))
+}
+
+func intParam(val string, defaultVal int) (int, bool) {
+	if val == "" {
+		return defaultVal, true
+	}
+	n, err := strconv.Atoi(val)
+	return n, err == nil && n >= 0
+}
+
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
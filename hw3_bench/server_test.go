@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func getUsers(t *testing.T, srv *httptest.Server, query string) (int, usersResponse) {
+	resp, err := http.Get(srv.URL + "/users" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	res := usersResponse{}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, res
+}
+
+func TestUsersServer(t *testing.T) {
+	s, err := NewUsersServer(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	_, all := getUsers(t, srv, "?browser=Android&browser=MSIE&limit=1000")
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	got := new(bytes.Buffer)
+	w := newResultWriter(got, OutputOptions{})
+	w.begin()
+	for _, u := range all.Users {
+		w.user(u.ID, u.Name, u.Email)
+	}
+	w.end(all.UniqueBrowsers)
+	if got.String() != expected.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, expected)
+	}
+	if all.Total != len(all.Users) {
+		t.Errorf("total %d, got %d users", all.Total, len(all.Users))
+	}
+
+	_, page := getUsers(t, srv, "?browser=Android&browser=MSIE&offset=2&limit=3")
+	if page.Total != all.Total || len(page.Users) != 3 || page.Users[0] != all.Users[2] {
+		t.Errorf("bad page: %+v", page)
+	}
+	_, tail := getUsers(t, srv, "?browser=Android&browser=MSIE&offset=1000")
+	if tail.Total != all.Total || tail.Users == nil || len(tail.Users) != 0 {
+		t.Errorf("bad page past the end: %+v", tail)
+	}
+	_, everyone := getUsers(t, srv, "")
+	if everyone.Total != 1000 || len(everyone.Users) != defaultUsersLimit {
+		t.Errorf("bad default page: total %d, %d users", everyone.Total, len(everyone.Users))
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=100000", "?offset=-1", "?limit=x"} {
+		if code, _ := getUsers(t, srv, query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, code)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("pprof: %d", resp.StatusCode)
+	}
+}
+
+func TestUsersServerReload(t *testing.T) {
+	files := writeTestInputs(t)
+	dir, plain := files.dir, files.plain
+	defer os.RemoveAll(dir)
+
+	s, err := NewUsersServer(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckInterval = 0
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	if _, res := getUsers(t, srv, "?browser=NewBrowser"); res.Total != 0 {
+		t.Fatalf("unexpected users: %+v", res)
+	}
+
+	data, _ := ioutil.ReadFile(plain)
+	extra := "\n" + `{"browsers":["NewBrowser/1.0"],"name":"New User","email":"new@example.com"}` + "\n"
+	if err := ioutil.WriteFile(plain, append(data, extra...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// перечитывание идёт в фоне: первый запрос его запускает и отвечает по старым данным
+	if _, res := getUsers(t, srv, "?browser=NewBrowser"); res.Total != 0 {
+		t.Errorf("request waited for reload: %+v", res)
+	}
+	s.reloads.Wait()
+	_, res := getUsers(t, srv, "?browser=NewBrowser")
+	if res.Total != 1 || res.Users[0] != (userResult{ID: 1000, Name: "New User", Email: "new@example.com"}) {
+		t.Errorf("file change not picked up: %+v", res)
+	}
+
+	// недописанный файл не ломает сервис - остаются старые данные
+	if err := ioutil.WriteFile(plain, append(data, `{"browsers":[`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Second)
+	os.Chtimes(plain, mtime, mtime)
+	getUsers(t, srv, "?browser=NewBrowser")
+	s.reloads.Wait()
+	if _, res := getUsers(t, srv, "?browser=NewBrowser"); res.Total != 1 {
+		t.Errorf("broken file replaced data: %+v", res)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"coursera/hw3_bench/jsonl"
+)
+
+// UserAgent - результат разбора строки браузера.
+type UserAgent struct {
+	Family string
+	// Version - мажорная версия браузера, пустая если не удалось определить.
+	Version string
+	OS      string
+}
+
+type familyRule struct {
+	token    string
+	family   string
+	requires string
+	// versionTokens - после какой подстроки искать версию, по порядку.
+	// Если не заданы - после token.
+	versionTokens []string
+}
+
+// familyRules проверяются по порядку, срабатывает первое совпадение.
+// Более специфичные браузеры стоят раньше тех, чьи токены они тоже содержат
+// (Edge и Opera пишут Chrome/, Chrome пишет Safari/ и т.д.).
+var familyRules = []familyRule{
+	{token: "Edge/", family: "Edge"},
+	{token: "OPR/", family: "Opera"},
+	{token: "Opera Mini/", family: "Opera Mini"},
+	{token: "Opera", family: "Opera", versionTokens: []string{"Version/", "Opera/", "Opera "}},
+	{token: "MSIE ", family: "IE"},
+	{token: "Trident/", family: "IE", versionTokens: []string{"rv:"}},
+	{token: "Maxthon/", family: "Maxthon"},
+	{token: "Konqueror/", family: "Konqueror"},
+	{token: "Iceape/", family: "SeaMonkey"},
+	{token: "SeaMonkey/", family: "SeaMonkey"},
+	{token: "Arora/", family: "Arora"},
+	{token: "QupZilla/", family: "QupZilla"},
+	{token: "NokiaBrowser/", family: "Nokia Browser"},
+	{token: "NetFront/", family: "NetFront"},
+	{token: "Lynx/", family: "Lynx"},
+	{token: "ELinks", family: "ELinks", versionTokens: []string{"ELinks/", "ELinks ("}},
+	{token: "Links", family: "Links", versionTokens: []string{"Links/", "Links ("}},
+	{token: "UP.Browser/", family: "UP.Browser"},
+	{token: "Galeon/", family: "Galeon"},
+	{token: "Epiphany/", family: "Epiphany"},
+	{token: "Midori/", family: "Midori"},
+	{token: "Dillo", family: "Dillo", versionTokens: []string{"Dillo "}},
+	{token: "Netscape/", family: "Netscape"},
+	{token: "Iceweasel/", family: "Firefox"},
+	{token: "Minefield/", family: "Firefox"},
+	{token: "Shiretoko/", family: "Firefox"},
+	{token: "Namoroka/", family: "Firefox"},
+	{token: "Wget/", family: "Wget"},
+	{token: "Chromium/", family: "Chromium"},
+	{token: "Firefox/", family: "Firefox"},
+	{token: "CriOS/", family: "Chrome"},
+	{token: "Chrome/", family: "Chrome"},
+	{token: "Android", family: "Android Browser", requires: "Version/", versionTokens: []string{"Version/"}},
+	{token: "Safari/", family: "Safari", versionTokens: []string{"Version/"}},
+	{token: "BlackBerry", family: "BlackBerry", versionTokens: []string{"Version/", "/"}},
+}
+
+// botTokens ищутся без учёта регистра, если браузер не распознан.
+var botTokens = []string{"bot", "spider", "crawler", "slurp", "jeeves", "feedfetcher", "mediapartners"}
+
+type osRule struct {
+	token string
+	os    string
+}
+
+var osRules = []osRule{
+	{"Windows Phone", "Windows Phone"},
+	{"Windows NT 10.0", "Windows 10"},
+	{"Windows NT 6.3", "Windows 8.1"},
+	{"Windows NT 6.2", "Windows 8"},
+	{"Windows NT 6.1", "Windows 7"},
+	{"Windows NT 6.0", "Windows Vista"},
+	{"Windows NT 5.1", "Windows XP"},
+	{"Windows NT 5.2", "Windows XP"},
+	{"Windows XP", "Windows XP"},
+	{"Windows NT 5.0", "Windows 2000"},
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "Chrome OS"},
+	{"BlackBerry", "BlackBerry"},
+	{"BB10", "BlackBerry"},
+	{"RIM Tablet", "BlackBerry"},
+	{"Symbian", "Symbian"},
+	{"FreeBSD", "FreeBSD"},
+	{"OpenBSD", "OpenBSD"},
+	{"Linux", "Linux"},
+	{"PalmOS", "Palm OS"},
+}
+
+// ParseUserAgent определяет браузер, его мажорную версию и ОС.
+// Неизвестное помечается как "Other", ботов - как "Bot".
+func ParseUserAgent(ua string) UserAgent {
+	res := UserAgent{Family: "Other", OS: "Other"}
+	for _, rule := range osRules {
+		if strings.Contains(ua, rule.token) {
+			res.OS = rule.os
+			break
+		}
+	}
+
+	for _, rule := range familyRules {
+		if !strings.Contains(ua, rule.token) {
+			continue
+		}
+		if rule.requires != "" && !strings.Contains(ua, rule.requires) {
+			continue
+		}
+		res.Family = rule.family
+		tokens := rule.versionTokens
+		if len(tokens) == 0 {
+			tokens = []string{rule.token}
+		}
+		for _, token := range tokens {
+			if version := versionAfter(ua, token); version != "" {
+				res.Version = version
+				break
+			}
+		}
+		return res
+	}
+
+	lower := strings.ToLower(ua)
+	for _, token := range botTokens {
+		if strings.Contains(lower, token) {
+			res.Family = "Bot"
+			break
+		}
+	}
+	return res
+}
+
+// versionAfter возвращает мажорную версию, записанную сразу после token.
+func versionAfter(ua, token string) string {
+	idx := strings.Index(ua, token)
+	if idx < 0 {
+		return ""
+	}
+	rest := ua[idx+len(token):]
+	end := 0
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+	return rest[:end]
+}
+
+// BrowserStats - статистика по браузерам пользователей.
+// Счётчики Families, OS и Versions считают записи в browsers, а не пользователей.
+type BrowserStats struct {
+	Users                  int
+	Browsers               int
+	UsersWithManyFamilies  int
+	Families, OS, Versions map[string]int
+
+	cache map[string]UserAgent
+}
+
+func NewBrowserStats() *BrowserStats {
+	return &BrowserStats{
+		Families: make(map[string]int),
+		OS:       make(map[string]int),
+		Versions: make(map[string]int),
+		cache:    make(map[string]UserAgent),
+	}
+}
+
+// Add учитывает одного пользователя.
+func (s *BrowserStats) Add(u *user) {
+	s.Users++
+	first, many := "", false
+	for _, browser := range u.Browsers {
+		ua, ok := s.cache[browser]
+		if !ok {
+			ua = ParseUserAgent(browser)
+			s.cache[browser] = ua
+		}
+		s.Browsers++
+		s.Families[ua.Family]++
+		s.OS[ua.OS]++
+		version := ua.Family
+		if ua.Version != "" {
+			version += " " + ua.Version
+		}
+		s.Versions[version]++
+
+		if first == "" {
+			first = ua.Family
+		} else if ua.Family != first {
+			many = true
+		}
+	}
+	if many {
+		s.UsersWithManyFamilies++
+	}
+}
+
+// ReadBrowserStats собирает статистику по JSON-строкам пользователей из r.
+func ReadBrowserStats(r io.Reader) (*BrowserStats, error) {
+	stats := NewBrowserStats()
+	lines := jsonl.NewReader(r)
+	u := &user{}
+	for lines.Next(u) {
+		stats.Add(u)
+		*u = user{Browsers: u.Browsers[:0]}
+	}
+	return stats, lines.Err()
+}
+
+type statsRow struct {
+	name  string
+	count int
+}
+
+// top возвращает topN самых частых значений, при равенстве - по алфавиту.
+// topN <= 0 - все значения.
+func top(counts map[string]int, topN int) []statsRow {
+	rows := make([]statsRow, 0, len(counts))
+	for name, count := range counts {
+		rows = append(rows, statsRow{name, count})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].count != rows[j].count {
+			return rows[i].count > rows[j].count
+		}
+		return rows[i].name < rows[j].name
+	})
+	if topN > 0 && len(rows) > topN {
+		rows = rows[:topN]
+	}
+	return rows
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// WriteReport выводит сводку и таблицы topN браузеров, ОС и версий.
+func (s *BrowserStats) WriteReport(out io.Writer, topN int) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "users\t%d\t\n", s.Users)
+	fmt.Fprintf(w, "browsers\t%d\t\n", s.Browsers)
+	fmt.Fprintf(w, "users with several browser families\t%d\t%.1f%%\t\n",
+		s.UsersWithManyFamilies, percent(s.UsersWithManyFamilies, s.Users))
+
+	tables := []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"families", s.Families},
+		{"os", s.OS},
+		{"versions", s.Versions},
+	}
+	for _, table := range tables {
+		fmt.Fprintf(w, "\ntop %s\t\t\t\n", table.title)
+		for _, row := range top(table.counts, topN) {
+			fmt.Fprintf(w, "%s\t%d\t%.1f%%\t\n", row.name, row.count, percent(row.count, s.Browsers))
+		}
+	}
+	return w.Flush()
+}
+
+// BrowserReport строит отчёт по браузерам для data/users.txt.
+func BrowserReport(out io.Writer, topN int) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	stats, err := ReadBrowserStats(file)
+	if err != nil {
+		panic(err)
+	}
+	if err := stats.WriteReport(out, topN); err != nil {
+		panic(err)
+	}
+}
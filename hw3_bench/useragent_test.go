@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected UserAgent
+	}{
+		{"Mozilla/5.0 (Windows NT 5.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/36.0.1985.67 Safari/537.36", UserAgent{"Chrome", "36", "Windows XP"}},
+		{"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko", UserAgent{"IE", "11", "Windows 10"}},
+		{"Mozilla/1.22 (compatible; MSIE 5.01; PalmOS 3.0) EudoraWeb 2.1", UserAgent{"IE", "5", "Palm OS"}},
+		{"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1", UserAgent{"Firefox", "10", "Android"}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 9_2 like Mac OS X) AppleWebKit/601.1.46 (KHTML, like Gecko) Version/9.0 Mobile/13C75 Safari/601.1", UserAgent{"Safari", "9", "iOS"}},
+		{"Mozilla/5.0 (Linux; U; Android 2.2; en-us; SCH-I800 Build/FROYO) AppleWebKit/533.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/533.1", UserAgent{"Android Browser", "4", "Android"}},
+		{"Opera/9.80 (X11; FreeBSD 8.1-RELEASE i386; Edition Next) Presto/2.12.388 Version/12.10", UserAgent{"Opera", "12", "FreeBSD"}},
+		{"Opera/7.50 (Windows XP; U)", UserAgent{"Opera", "7", "Windows XP"}},
+		{"Opera/9.80 (Android; Opera Mini/7.5.33361/31.1543; U; en) Presto/2.8.119 Version/11.1010", UserAgent{"Opera Mini", "7", "Android"}},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/534.24 (KHTML, like Gecko) Ubuntu/10.10 Chromium/12.0.703.0 Chrome/12.0.703.0 Safari/534.24", UserAgent{"Chromium", "12", "Linux"}},
+		{"Gulper Web Bot 0.2.4 (www.ecsl.cs.sunysb.edu/~maxim/cgi-bin/Link/GulperBot)", UserAgent{"Bot", "", "Other"}},
+		{"ELinks (0.4.3; NetBSD 3.0.2PATCH sparc64; 141x19)", UserAgent{"ELinks", "0", "Other"}},
+		{"Links (2.1pre15; Linux 2.4.26 i686; 158x61)", UserAgent{"Links", "2", "Linux"}},
+		{"BlackBerry9700/5.0.0.351 Profile/MIDP-2.1 Configuration/CLDC-1.1 VendorID/123", UserAgent{"BlackBerry", "5", "BlackBerry"}},
+		{"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)", UserAgent{"Bot", "", "Other"}},
+		{"DoCoMo/2.0 SH901iC(c100;TB;W24H12)", UserAgent{"Other", "", "Other"}},
+	}
+	for _, c := range cases {
+		if got := ParseUserAgent(c.ua); got != c.expected {
+			t.Errorf("%s\nGot: %+v\nExpected: %+v", c.ua, got, c.expected)
+		}
+	}
+}
+
+func TestBrowserStats(t *testing.T) {
+	input := strings.Join([]string{
+		`{"name":"a","browsers":["Mozilla/5.0 (Windows NT 6.1) Chrome/41.0 Safari/537.36","Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)"]}`,
+		`{"name":"b","browsers":["Mozilla/5.0 (Windows NT 6.1) Chrome/41.0 Safari/537.36","Mozilla/5.0 (Windows NT 6.1) Chrome/40.0 Safari/537.36"]}`,
+		`{"name":"c","browsers":[]}`,
+	}, "\n")
+	stats, err := ReadBrowserStats(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Users != 3 || stats.Browsers != 4 || stats.UsersWithManyFamilies != 1 {
+		t.Errorf("unexpected totals %+v", stats)
+	}
+	if stats.Families["Chrome"] != 3 || stats.OS["Windows 7"] != 3 || stats.Versions["Chrome 41"] != 2 || stats.Versions["IE 7"] != 1 {
+		t.Errorf("unexpected counts %v %v %v", stats.Families, stats.OS, stats.Versions)
+	}
+
+	out := new(bytes.Buffer)
+	if err := stats.WriteReport(out, 1); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	for _, expected := range []string{"33.3%", "top families", "Chrome", "Windows 7", "Chrome 41"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("report does not contain %q:\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "IE 7") {
+		t.Errorf("report is not limited to top 1:\n%s", report)
+	}
+}
+
+func TestBrowserReport(t *testing.T) {
+	out := new(bytes.Buffer)
+	BrowserReport(out, 5)
+	if !strings.HasPrefix(out.String(), "users") || strings.Count(out.String(), "\n") != 3+3*7 {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,9 +20,13 @@ const (
 
 var (
 	errTest = errors.New("testing")
-	client  = &http.Client{Timeout: time.Second}
+	// client - http.Client по умолчанию, таймаут задаётся через контекст
+	client = &http.Client{}
 )
 
+// defaultTimeout - таймаут одного запроса, если не задан SearchClient.Timeout
+const defaultTimeout = time.Second
+
 type User struct {
 	Id     int
 	Name   string
@@ -37,6 +42,8 @@ type SearchResponse struct {
 
 type SearchErrorResponse struct {
 	Error string
+	// Detail - подробности ошибки, например место ошибки в query
+	Detail string
 }
 
 const (
@@ -45,15 +52,31 @@ const (
 	OrderByDesc = 1
 
 	ErrorBadOrderField = `OrderField invalid`
+
+	// MaxLimit - больше пользователей за раз FindUsers не запрашивает
+	MaxLimit = 25
+)
+
+// Значения SearchRequest.OrderField, пустое - OrderFieldName.
+const (
+	OrderFieldId   = "Id"
+	OrderFieldAge  = "Age"
+	OrderFieldName = "Name"
+	// OrderFieldRelevance - по релевантности Query: при OrderByAsIs и
+	// OrderByDesc самые подходящие первыми, при OrderByAsc - последними;
+	// слова Query находят и другие свои формы: runs - running
+	OrderFieldRelevance = "Relevance"
 )
 
 type SearchRequest struct {
 	Limit      int
 	Offset     int    // Можно учесть после сортировки
-	Query      string // подстрока в 1 из полей
+	Query      string // подстрока в 1 из полей или выражение, см. searchserver/query.go
 	OrderField string
 	// -1 по убыванию, 0 как встретилось, 1 по возрастанию
 	OrderBy int
+	// Filters - условия на отдельные поля, объединяются с Query через AND
+	Filters []Filter
 }
 
 type SearchClient struct {
@@ -61,21 +84,46 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// Prefetch - AllUsers запрашивает следующую страницу, пока читается текущая
+	Prefetch bool
+	// HTTPClient - через что ходить во внешнюю систему, по умолчанию client
+	HTTPClient *http.Client
+	// Timeout - таймаут одной попытки, по умолчанию defaultTimeout
+	Timeout time.Duration
+	// Retry - повторы при таймаутах и ответах 5xx, по умолчанию повторов нет
+	Retry RetryPolicy
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext как FindUsers, но запрос прерывается при отмене ctx.
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+
+	resp, err := srv.findUsers(ctx, req)
+	if err, ok := err.(*SearchError); ok {
+		err.Request = req
+	}
+	return resp, err
+}
+
+func (srv *SearchClient) findUsers(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return nil, newSearchError(ErrBadLimit, nil, nil, ErrBadLimit.Error())
 	}
-	if req.Limit > 25 {
-		req.Limit = 25
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return nil, newSearchError(ErrBadOffset, nil, nil, ErrBadOffset.Error())
+	}
+	if err := req.checkQuery(); err != nil {
+		return nil, err
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
@@ -83,44 +131,76 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams.Add("limit", strconv.Itoa(req.Limit))
 	searcherParams.Add("offset", strconv.Itoa(req.Offset))
-	searcherParams.Add("query", req.Query)
+	searcherParams.Add("query", req.query())
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-	
-	resp, err := client.Do(searcherReq)
-	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+	var (
+		resp *searcherResponse
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		resp, err = srv.do(ctx, searcherParams)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		timeout := errors.Is(err, ErrTimeout)
+		if err != nil && !timeout {
+			return nil, err
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
+
+		if (timeout || resp.StatusCode >= 500) && attempt < srv.Retry.attempts() {
+			var header http.Header
+			if resp != nil {
+				header = resp.Header
+			}
+			if d, ok := srv.Retry.delay(attempt, header); ok {
+				if err := sleepContext(ctx, d); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if timeout {
+			return nil, err
+		}
+		break
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	body := resp.Body
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
-	case http.StatusBadRequest:
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, newSearchError(ErrBadAccessToken, resp, nil, "Bad AccessToken")
+	case resp.StatusCode >= 500:
+		return nil, newSearchError(ErrServer, resp, nil, "SearchServer fatal error")
+	case resp.StatusCode == http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, newSearchError(ErrBadResponse, resp, err, fmt.Sprintf("cant unpack error json: %s", err))
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderField %s invalid", req.OrderField)
+			e := newSearchError(ErrBadOrderField, resp, nil, fmt.Sprintf("OrderField %s invalid", req.OrderField))
+			e.Message = errResp.Error
+			return nil, e
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		if errResp.Error == "ErrorBadQuery" {
+			e := newSearchError(ErrBadQuery, resp, nil, fmt.Sprintf("query %q invalid: %s", req.query(), errResp.Detail))
+			e.Message = errResp.Error
+			return nil, e
+		}
+		e := newSearchError(ErrBadRequest, resp, nil, fmt.Sprintf("unknown bad request error: %s", errResp.Error))
+		e.Message = errResp.Error
+		return nil, e
+	default:
+		return nil, newSearchError(ErrBadResponse, resp, nil, fmt.Sprintf("unexpected status %d", resp.StatusCode))
 	}
 
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, newSearchError(ErrBadResponse, resp, err, fmt.Sprintf("cant unpack result json: %s", err))
 	}
 
 	result := SearchResponse{}
@@ -133,3 +213,44 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	return &result, err
 }
+
+type searcherResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// do делает одну попытку запроса с таймаутом srv.Timeout.
+func (srv *SearchClient) do(ctx context.Context, params url.Values) (*searcherResponse, error) {
+	timeout := srv.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, newSearchError(ErrTransport, nil, err, fmt.Sprintf("cant create request: %s", err))
+	}
+	searcherReq = searcherReq.WithContext(ctx)
+	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+
+	httpClient := srv.HTTPClient
+	if httpClient == nil {
+		httpClient = client
+	}
+	resp, err := httpClient.Do(searcherReq)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, newSearchError(ErrTimeout, nil, err, fmt.Sprintf("timeout for %s", params.Encode()))
+		}
+		return nil, newSearchError(ErrTransport, nil, err, fmt.Sprintf("unknown error %s", err))
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newSearchError(ErrBadResponse, &searcherResponse{StatusCode: resp.StatusCode}, err, fmt.Sprintf("cant read response: %s", err))
+	}
+	return &searcherResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
@@ -1,20 +1,21 @@
 package main
 
 import (
-	"encoding/json"
-	"encoding/xml"
-	"log"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"sort"
-	"strconv"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"coursera/hw4_test_coverage/searchserver"
 )
 
-var handler = SearchServer{dataStore: "dataset.xml"}
+var handler = mustLoadServer("dataset.xml")
 var server = httptest.NewServer(handler)
 var searchClient = SearchClient{URL: server.URL}
 
@@ -207,136 +208,535 @@ func (server badServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	server.handle(w, r)
 }
 
-type SearchServer struct {
-	dataStore string
+func mustLoadServer(path string) *searchserver.Server {
+	srv, err := searchserver.NewFromFile(path)
+	if err != nil {
+		panic(err)
+	}
+	return srv
 }
 
-func (server SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	searchRequest, err := parseSearchRequest(r)
-	if err != nil {
-		http.Error(w, "could not parse search requst", http.StatusBadRequest)
-		log.Println(err)
-		return
+func readAllPages(t *testing.T) []User {
+	var users []User
+	for offset, nextPage := 0, true; nextPage; offset += MaxLimit {
+		res, err := searchClient.FindUsers(SearchRequest{Limit: MaxLimit, Offset: offset})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		users = append(users, res.Users...)
+		nextPage = res.NextPage
 	}
+	return users
+}
 
-	file, err := os.Open(server.dataStore)
-	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	type container struct {
-		Rows []struct {
-			Id        int    `xml:"id"`
-			Name      string `xml:"name"`
-			Age       int    `xml:"age"`
-			About     string `xml:"about"`
-			Gender    string `xml:"gender"`
-			FirstName string `xml:"first_name"`
-			LastName  string `xml:"last_name"`
-		} `xml:"row"`
-	}
-
-	var data container
-	decoder := xml.NewDecoder(file)
-	err = decoder.Decode(&data)
-	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		log.Println(err)
-		return
+func TestAllUsers(t *testing.T) {
+	expected := readAllPages(t)
+	for _, prefetch := range []bool{false, true} {
+		for _, limit := range []int{0, 1, 7, 25, 100} {
+			client := SearchClient{URL: server.URL, Prefetch: prefetch}
+			it := client.AllUsers(context.Background(), SearchRequest{Limit: limit})
+			var users []User
+			for it.Next() {
+				users = append(users, it.User())
+			}
+			it.Close()
+			if it.Err() != nil {
+				t.Errorf("prefetch %v, limit %d: unexpected error: %v", prefetch, limit, it.Err())
+			}
+			if !reflect.DeepEqual(users, expected) {
+				t.Errorf("prefetch %v, limit %d: got %d users, expected %d", prefetch, limit, len(users), len(expected))
+			}
+			if it.Next() {
+				t.Errorf("prefetch %v, limit %d: Next after the end", prefetch, limit)
+			}
+		}
 	}
 
-	var searchResults []User
-	for _, row := range data.Rows {
-		row.Name = row.FirstName + " " + row.LastName
-		if strings.Contains(row.FirstName, searchRequest.Query) ||
-			strings.Contains(row.LastName, searchRequest.Query) ||
-			strings.Contains(row.About, searchRequest.Query) {
+	it := searchClient.AllUsers(context.Background(), SearchRequest{Offset: 30, Query: "Boyd"})
+	defer it.Close()
+	if it.Next() || it.Err() != nil {
+		t.Errorf("expected no users, got %v, %v", it.User(), it.Err())
+	}
+}
 
-			if searchRequest.Offset > 0 {
-				searchRequest.Offset--
-				continue
+func TestAllUsersError(t *testing.T) {
+	handler := badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("offset") != "0" {
+				http.Error(w, "error:)", http.StatusInternalServerError)
+				return
 			}
+			handler.ServeHTTP(w, r)
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, prefetch := range []bool{false, true} {
+		client := SearchClient{URL: server.URL, Prefetch: prefetch}
+		it := client.AllUsers(context.Background(), SearchRequest{Limit: 10})
+		n := 0
+		for it.Next() {
+			n++
+		}
+		if n != 10 || it.Err() == nil {
+			t.Errorf("prefetch %v: expected error after first page, got %d users, %v", prefetch, n, it.Err())
+		}
+	}
 
-			newResult := User{
-				Id:     row.Id,
-				Name:   row.Name,
-				Age:    row.Age,
-				About:  row.About,
-				Gender: row.Gender,
-			}
-			searchResults = append(searchResults, newResult)
+	it := searchClient.AllUsers(context.Background(), SearchRequest{Limit: -1})
+	if it.Next() || it.Err() == nil {
+		t.Errorf("did not get an error for invalid limit")
+	}
+}
+
+func TestAllUsersCancel(t *testing.T) {
+	for _, prefetch := range []bool{false, true} {
+		client := SearchClient{URL: server.URL, Prefetch: prefetch}
+		ctx, cancel := context.WithCancel(context.Background())
+		it := client.AllUsers(ctx, SearchRequest{Limit: 5})
+		if !it.Next() {
+			t.Fatalf("prefetch %v: unexpected error: %v", prefetch, it.Err())
+		}
+		cancel()
+		if it.Next() || it.Err() != context.Canceled {
+			t.Errorf("prefetch %v: expected context.Canceled, got %v", prefetch, it.Err())
+		}
+	}
+
+	// отмена, пока итератор ждёт страницу
+	ctx, cancel := context.WithCancel(context.Background())
+	it := (&SearchClient{URL: server.URL}).AllUsers(ctx, SearchRequest{})
+	cancel()
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", it.Err())
+	}
+
+	if page := it.fetch(); page.err != context.Canceled {
+		t.Errorf("fetch after cancel: expected context.Canceled, got %v", page.err)
+	}
+	if it.Next() {
+		t.Errorf("Next after error")
+	}
 
-			if len(searchResults) == searchRequest.Limit {
-				break
+	// отмена, пока итератор ждёт страницу от предзагрузки
+	release := make(chan struct{})
+	slow := httptest.NewServer(badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		},
+	})
+	defer slow.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	it = (&SearchClient{URL: slow.URL, Prefetch: true}).AllUsers(ctx, SearchRequest{})
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled while waiting for prefetch, got %v", it.Err())
+	}
+	close(release)
+	it.Close()
+
+	// Close во время предзагрузки останавливает её
+	client := SearchClient{URL: server.URL, Prefetch: true}
+	it = client.AllUsers(context.Background(), SearchRequest{Limit: 5})
+	if !it.Next() {
+		t.Fatalf("unexpected error: %v", it.Err())
+	}
+	it.Close()
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled after Close, got %v", it.Err())
+	}
+}
+
+func TestFindUsersContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := searchClient.FindUsersContext(ctx, SearchRequest{Limit: 10}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	handler := badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	client := SearchClient{URL: server.URL}
+	if _, err := client.FindUsersContext(ctx, SearchRequest{Limit: 10}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	client.Timeout = 20 * time.Millisecond
+	start := time.Now()
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || !strings.HasPrefix(err.Error(), "timeout for") {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Timeout ignored: request took %v", elapsed)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestHTTPClient(t *testing.T) {
+	requests := 0
+	client := SearchClient{
+		URL: server.URL,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(r)
+		})},
+	}
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("HTTPClient not used")
+	}
+
+	client = SearchClient{URL: ":bad url"}
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || !strings.HasPrefix(err.Error(), "cant create request") {
+		t.Errorf("expected request error, got %v", err)
+	}
+
+	handler := badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("[]"))
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client = SearchClient{URL: server.URL}
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || !strings.HasPrefix(err.Error(), "cant read response") {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+// flakyServer отвечает кодом из codes на очередной запрос, а когда они
+// кончаются - как обычный SearchServer.
+func flakyServer(header http.Header, codes ...int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= len(codes) {
+				for key, val := range header {
+					w.Header()[key] = val
+				}
+				http.Error(w, "error:)", codes[requests-1])
+				return
 			}
+			handler.ServeHTTP(w, r)
+		},
+	})
+	return server, &requests
+}
+
+func TestRetry(t *testing.T) {
+	server, requests := flakyServer(nil, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	defer server.Close()
+	client := SearchClient{URL: server.URL, Retry: RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}}
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+
+	server, requests = flakyServer(nil, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer server.Close()
+	client.URL = server.URL
+	client.Retry.Attempts = 2
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || err.Error() != "SearchServer fatal error" {
+		t.Errorf("expected server error, got %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("expected 2 requests, got %d", *requests)
+	}
+
+	// любой 5xx после последней попытки - ErrServer с кодом ответа
+	for _, code := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		server, requests = flakyServer(nil, code, code)
+		defer server.Close()
+		client.URL = server.URL
+		_, err := client.FindUsers(SearchRequest{Limit: 10})
+		searchErr := &SearchError{}
+		if !errors.Is(err, ErrServer) || !errors.As(err, &searchErr) || searchErr.StatusCode != code {
+			t.Errorf("%d: expected server error, got %v", code, err)
+		}
+		if *requests != 2 {
+			t.Errorf("%d: expected 2 requests, got %d", code, *requests)
 		}
 	}
 
-	var less func(i, j int) bool
-	switch searchRequest.OrderField {
-	case "Id":
-		less = func(i, j int) bool {
-			return searchResults[i].Id < searchResults[j].Id
+	// 4xx не повторяется
+	server, requests = flakyServer(nil, http.StatusUnauthorized)
+	defer server.Close()
+	client.URL = server.URL
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || *requests != 1 {
+		t.Errorf("expected single failed request, got %v after %d requests", err, *requests)
+	}
+
+	// таймаут повторяется
+	slowOnce := int32(0)
+	slow := httptest.NewServer(badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&slowOnce, 1) == 1 {
+				time.Sleep(200 * time.Millisecond)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		},
+	})
+	defer slow.Close()
+	client = SearchClient{URL: slow.URL, Timeout: 50 * time.Millisecond, Retry: RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond}}
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server, requests := flakyServer(http.Header{"Retry-After": {"1"}}, http.StatusServiceUnavailable)
+	defer server.Close()
+	client := SearchClient{URL: server.URL, Retry: RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond}}
+	start := time.Now()
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); *requests != 2 || elapsed < time.Second {
+		t.Errorf("Retry-After ignored: %d requests in %v", *requests, elapsed)
+	}
+
+	// сервер просит ждать дольше MaxDelay - не повторяем
+	server, requests = flakyServer(http.Header{"Retry-After": {"86400"}}, http.StatusServiceUnavailable)
+	defer server.Close()
+	client.URL = server.URL
+	start = time.Now()
+	if _, err := client.FindUsers(SearchRequest{Limit: 10}); err == nil || *requests != 1 || time.Since(start) > time.Second {
+		t.Errorf("expected single failed request, got %v after %d requests in %v", err, *requests, time.Since(start))
+	}
+	if _, ok := (RetryPolicy{MaxDelay: time.Second}).delay(1, http.Header{"Retry-After": {"2"}}); ok {
+		t.Errorf("Retry-After above MaxDelay accepted")
+	}
+
+	// отмена во время паузы
+	server, _ = flakyServer(http.Header{"Retry-After": {"10"}}, http.StatusServiceUnavailable)
+	defer server.Close()
+	client.URL = server.URL
+	client.Retry.MaxDelay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.FindUsersContext(ctx, SearchRequest{Limit: 10}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	for val, expected := range map[string]time.Duration{
+		"":                              -1,
+		"x":                             -1,
+		"-5":                            -1,
+		"3":                             3 * time.Second,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+		time.Now().Add(time.Hour).UTC().Format(http.TimeFormat): time.Hour,
+	} {
+		d, ok := retryAfter(http.Header{"Retry-After": {val}})
+		if expected < 0 && ok || expected >= 0 && (!ok || d > expected || d < expected-time.Second) {
+			t.Errorf("Retry-After %q: got %v, %v", val, d, ok)
 		}
-	case "Age":
-		less = func(i, j int) bool {
-			return searchResults[i].Age < searchResults[j].Age
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 80 * time.Millisecond}
+	for attempt, max := range []time.Duration{0, 10, 20, 40, 80, 80, 80} {
+		if attempt == 0 {
+			continue
 		}
-	case "Name", "":
-		less = func(i, j int) bool {
-			return searchResults[i].Name < searchResults[j].Name
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d, _ := p.delay(attempt, nil); d < max/2 || d > max {
+				t.Errorf("attempt %d: delay %v out of [%v, %v]", attempt, d, max/2, max)
+			}
 		}
-	default:
-		http.Error(w, `{"error":"ErrorBadOrderField"}`, http.StatusBadRequest)
-		return
 	}
+	if d, _ := (RetryPolicy{}).delay(100, nil); d > defaultRetryMaxDelay || d < defaultRetryMaxDelay/2 {
+		t.Errorf("default delay %v", d)
+	}
+	if d, _ := (RetryPolicy{}).delay(1, nil); d > defaultRetryBaseDelay {
+		t.Errorf("default base delay %v", d)
+	}
+}
 
-	switch searchRequest.OrderBy {
-	case OrderByAsc:
-		sort.Slice(searchResults, less)
-	case OrderByDesc:
-		sort.Slice(searchResults, func(i, j int) bool { return !less(i, j) })
-	case OrderByAsIs:
-	default:
-		http.Error(w, `{"error":"ErrorBadOrderBy"}`, http.StatusBadRequest)
-		return
+func TestFilters(t *testing.T) {
+	all := readAllPages(t)
+	cases := []struct {
+		req      SearchRequest
+		expected func(u User) bool
+	}{
+		{SearchRequest{Query: "BOYD"}, func(u User) bool { return strings.Contains(u.Name, "Boyd") }},
+		{SearchRequest{Filters: []Filter{{Field: "gender", Value: "female"}, {Field: "age", Op: ">", Value: "30"}}},
+			func(u User) bool { return u.Gender == "female" && u.Age > 30 }},
+		{SearchRequest{Query: "name:boyd OR name:hilda", Filters: []Filter{{Field: "age", Op: "<", Value: "30"}}},
+			func(u User) bool {
+				return (strings.Contains(u.Name, "Boyd") || strings.Contains(u.Name, "Hilda")) && u.Age < 30
+			}},
+		{SearchRequest{Query: " ", Filters: []Filter{{Field: "name", Value: "boyd wolf"}}},
+			func(u User) bool { return u.Name == "Boyd Wolf" }},
+	}
+	for _, c := range cases {
+		c.req.Limit = MaxLimit
+		var got []User
+		it := searchClient.AllUsers(context.Background(), c.req)
+		for it.Next() {
+			got = append(got, it.User())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("%+v: %v", c.req, err)
+		}
+		var expected []User
+		for _, u := range all {
+			if c.expected(u) {
+				expected = append(expected, u)
+			}
+		}
+		if len(expected) == 0 || !reflect.DeepEqual(got, expected) {
+			t.Errorf("%+v: got %v, expected %v", c.req, got, expected)
+		}
 	}
 
-	jsonResult, err := json.Marshal(searchResults)
-	_, err = w.Write(jsonResult)
-	if err != nil {
-		log.Println(err)
-		return
+	f := Filter{Field: "about", Value: `say "hi" \`}
+	if s := f.String(); s != `about:"say \"hi\" \\"` {
+		t.Errorf("bad filter string %s", s)
 	}
 }
 
-func parseSearchRequest(r *http.Request) (*SearchRequest, error) {
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
-	if err != nil {
-		return nil, err
+func TestSelfContained(t *testing.T) {
+	for q, expected := range map[string]bool{
+		"":                 true,
+		"(a OR b) c":       true,
+		`about:"x) OR (y"`: true,
+		`name:"a \" )"`:    true,
+		"a) OR (b":         false,
+		"(a":               false,
+		"a)":               false,
+		`"a`:               false,
+		`about:"a\"`:       false,
+	} {
+		if got := selfContained(q); got != expected {
+			t.Errorf("%q: got %v, expected %v", q, got, expected)
+		}
 	}
+}
 
-	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
-	if err != nil {
-		return nil, err
+func TestRelevance(t *testing.T) {
+	req := SearchRequest{Query: "lorem OR about:laborum", OrderField: OrderFieldRelevance, Limit: 4}
+	var ranked []User
+	it := searchClient.AllUsers(context.Background(), req)
+	for it.Next() {
+		ranked = append(ranked, it.User())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
 	}
 
-	query := r.URL.Query().Get("query")
-	orderField := r.URL.Query().Get("order_field")
+	req.OrderField, req.OrderBy = OrderFieldId, OrderByAsc
+	byID := []User{}
+	it = searchClient.AllUsers(context.Background(), req)
+	for it.Next() {
+		byID = append(byID, it.User())
+	}
+	if len(ranked) != len(byID) || len(ranked) < 2 {
+		t.Fatalf("got %d ranked users, %d by id", len(ranked), len(byID))
+	}
+	seen := make(map[int]bool)
+	for _, u := range ranked {
+		seen[u.Id] = true
+	}
+	for _, u := range byID {
+		if !seen[u.Id] {
+			t.Errorf("user %d missing from ranked results", u.Id)
+		}
+	}
+	if reflect.DeepEqual(ranked, byID) {
+		t.Errorf("relevance order is the same as Id order")
+	}
+}
 
-	orderBy, err := strconv.Atoi(r.URL.Query().Get("order_by"))
-	if err != nil {
-		return nil, err
+func TestSearchErrors(t *testing.T) {
+	unauthorized, _ := flakyServer(nil, http.StatusUnauthorized)
+	defer unauthorized.Close()
+	fatal, _ := flakyServer(nil, http.StatusInternalServerError)
+	defer fatal.Close()
+	notFound, _ := flakyServer(nil, http.StatusNotFound)
+	defer notFound.Close()
+	badGateway, _ := flakyServer(nil, http.StatusBadGateway)
+	defer badGateway.Close()
+	unavailable, _ := flakyServer(nil, http.StatusServiceUnavailable)
+	defer unavailable.Close()
+	gatewayTimeout, _ := flakyServer(nil, http.StatusGatewayTimeout)
+	defer gatewayTimeout.Close()
+	slow := httptest.NewServer(badServer{
+		handle: func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		},
+	})
+	defer slow.Close()
+
+	cases := []struct {
+		client  SearchClient
+		req     SearchRequest
+		kind    error
+		status  int
+		message string
+	}{
+		{searchClient, SearchRequest{Limit: -1}, ErrBadLimit, 0, ""},
+		{searchClient, SearchRequest{Offset: -1}, ErrBadOffset, 0, ""},
+		{searchClient, SearchRequest{OrderField: "phone"}, ErrBadOrderField, http.StatusBadRequest, "ErrorBadOrderField"},
+		{searchClient, SearchRequest{OrderBy: 42}, ErrBadRequest, http.StatusBadRequest, "ErrorBadOrderBy"},
+		{searchClient, SearchRequest{Query: "(boyd"}, ErrBadQuery, http.StatusBadRequest, "ErrorBadQuery"},
+		{searchClient, SearchRequest{Filters: []Filter{{Field: "phone", Value: "1"}}}, ErrBadQuery, 0, ""},
+		{searchClient, SearchRequest{Filters: []Filter{{Field: `name:"x" OR id`, Value: "1"}}}, ErrBadQuery, 0, ""},
+		{searchClient, SearchRequest{Filters: []Filter{{Field: "name", Op: ">", Value: "boyd"}}}, ErrBadQuery, 0, ""},
+		{searchClient, SearchRequest{Filters: []Filter{{Field: "age", Op: "!=", Value: "30"}}}, ErrBadQuery, 0, ""},
+		{searchClient, SearchRequest{Query: "boyd) OR (hilda", Filters: []Filter{{Field: "gender", Value: "female"}}}, ErrBadQuery, 0, ""},
+		{SearchClient{URL: unauthorized.URL}, SearchRequest{}, ErrBadAccessToken, http.StatusUnauthorized, "error:)"},
+		{SearchClient{URL: fatal.URL}, SearchRequest{}, ErrServer, http.StatusInternalServerError, "error:)"},
+		{SearchClient{URL: notFound.URL}, SearchRequest{}, ErrBadResponse, http.StatusNotFound, "error:)"},
+		{SearchClient{URL: badGateway.URL}, SearchRequest{}, ErrServer, http.StatusBadGateway, "error:)"},
+		{SearchClient{URL: unavailable.URL}, SearchRequest{}, ErrServer, http.StatusServiceUnavailable, "error:)"},
+		{SearchClient{URL: gatewayTimeout.URL}, SearchRequest{}, ErrServer, http.StatusGatewayTimeout, "error:)"},
+		{SearchClient{URL: slow.URL, Timeout: 10 * time.Millisecond}, SearchRequest{Query: "x"}, ErrTimeout, 0, ""},
+		{SearchClient{URL: "http://127.0.0.1:1"}, SearchRequest{}, ErrTransport, 0, ""},
+	}
+	for _, c := range cases {
+		_, err := c.client.FindUsers(c.req)
+		if !errors.Is(err, c.kind) {
+			t.Errorf("%+v: expected %v, got %v", c.req, c.kind, err)
+			continue
+		}
+		searchErr := &SearchError{}
+		if !errors.As(err, &searchErr) {
+			t.Errorf("%+v: not a SearchError: %v", c.req, err)
+			continue
+		}
+		if searchErr.StatusCode != c.status || searchErr.Message != c.message || !reflect.DeepEqual(searchErr.Request, c.req) {
+			t.Errorf("%+v: unexpected error details: %+v", c.req, searchErr)
+		}
 	}
 
-	searchRequest := SearchRequest{
-		Limit:      limit,
-		Offset:     offset,
-		Query:      query,
-		OrderField: orderField,
-		OrderBy:    orderBy,
+	_, err := (&SearchClient{URL: slow.URL, Timeout: 10 * time.Millisecond}).FindUsers(SearchRequest{})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("timeout does not wrap net.Error: %v", err)
+	}
+	if errors.Is(err, ErrServer) {
+		t.Errorf("timeout is ErrServer")
 	}
-	return &searchRequest, nil
 }
@@ -0,0 +1,33 @@
+// searchserver - SearchServer отдельным сервисом:
+//
+//	searchserver -addr :8081 -dataset dataset.xml -tokens secret1,secret2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"coursera/hw4_test_coverage/searchserver"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "адрес сервиса")
+	dataset := flag.String("dataset", "dataset.xml", "файл с пользователями")
+	tokens := flag.String("tokens", os.Getenv("SEARCH_TOKENS"), "допустимые AccessToken через запятую, по умолчанию из SEARCH_TOKENS")
+	flag.Parse()
+
+	if *tokens == "" {
+		log.Fatal("no access tokens: set -tokens or SEARCH_TOKENS")
+	}
+	srv, err := searchserver.NewFromFile(*dataset, strings.Split(*tokens, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("starting server at", *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Ошибки FindUsers. Все они приходят обёрнутыми в *SearchError, проверять
+// их нужно через errors.Is:
+//
+//	_, err := client.FindUsers(req)
+//	if errors.Is(err, ErrBadOrderField) {
+//	}
+//
+// Отмена контекста возвращается как есть: context.Canceled или
+// context.DeadlineExceeded.
+var (
+	ErrBadLimit       = errors.New("limit must be > 0")
+	ErrBadOffset      = errors.New("offset must be > 0")
+	ErrBadAccessToken = errors.New("Bad AccessToken")
+	// ErrServer - сервер ответил 5xx, код в SearchError.StatusCode
+	ErrServer        = errors.New("SearchServer fatal error")
+	ErrBadOrderField = errors.New(ErrorBadOrderField)
+	// ErrBadQuery - сервер не смог разобрать Query или Filters
+	ErrBadQuery = errors.New("bad query")
+	// ErrBadRequest - прочие ответы 400, текст ошибки сервера в SearchError.Message
+	ErrBadRequest = errors.New("bad request")
+	// ErrTimeout - запрос не уложился в SearchClient.Timeout
+	ErrTimeout = errors.New("timeout")
+	// ErrTransport - запрос не удалось отправить или получить ответ
+	ErrTransport = errors.New("request failed")
+	// ErrBadResponse - ответ не удалось прочитать или разобрать либо
+	// у него неожиданный код
+	ErrBadResponse = errors.New("bad response")
+)
+
+// SearchError - ошибка FindUsers с подробностями.
+type SearchError struct {
+	// Err - одна из ошибок выше
+	Err error
+	// StatusCode - HTTP-код ответа, 0 - ответа не было
+	StatusCode int
+	// Message - текст ошибки от сервера, если он есть
+	Message string
+	// Request - запрос, как его передали в FindUsers
+	Request SearchRequest
+	// Cause - исходная ошибка: net.Error, ошибка разбора JSON и т.п.
+	Cause error
+
+	text string
+}
+
+func (e *SearchError) Error() string {
+	return e.text
+}
+
+// Is позволяет проверять вид ошибки через errors.Is(err, ErrTimeout).
+func (e *SearchError) Is(target error) bool {
+	return e.Err == target
+}
+
+// Unwrap отдаёт исходную ошибку, например для errors.As(err, &netErr).
+func (e *SearchError) Unwrap() error {
+	return e.Cause
+}
+
+func newSearchError(kind error, resp *searcherResponse, cause error, text string) *SearchError {
+	e := &SearchError{Err: kind, Cause: cause, text: text}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			e.Message = strings.TrimSpace(string(resp.Body))
+		}
+	}
+	return e
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter - условие на одно поле пользователя. Все фильтры из
+// SearchRequest.Filters должны выполняться вместе с Query:
+//
+//	SearchRequest{Query: "boyd OR hilda", Filters: []Filter{
+//		{Field: "gender", Value: "female"},
+//		{Field: "age", Op: ">", Value: "30"},
+//	}}
+type Filter struct {
+	// Field - name, about, gender, age или id
+	Field string
+	// Op - для age и id одно из =, >, >=, <, <=, пустой - равенство;
+	// для остальных полей должен быть пустым
+	Op    string
+	Value string
+}
+
+// String записывает фильтр в синтаксисе query: field:op"value".
+func (f Filter) String() string {
+	value := strings.Replace(f.Value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return f.Field + ":" + f.Op + `"` + value + `"`
+}
+
+// filterFields - поля, по которым можно фильтровать; true - поле числовое,
+// и для него допустимы сравнения из filterOps.
+var filterFields = map[string]bool{
+	"name":   false,
+	"about":  false,
+	"gender": false,
+	"age":    true,
+	"id":     true,
+}
+
+var filterOps = map[string]bool{
+	"":   true,
+	"=":  true,
+	">":  true,
+	">=": true,
+	"<":  true,
+	"<=": true,
+}
+
+// checkQuery проверяет фильтры и то, что Query с ними можно взять в скобки:
+// иначе Query вроде "a) OR (b" вышел бы из скобок, и OR обошёл бы фильтры.
+// Field и Op попадают в query без экранирования, поэтому принимаются только
+// известные значения.
+func (req *SearchRequest) checkQuery() error {
+	for _, f := range req.Filters {
+		numeric, ok := filterFields[f.Field]
+		if !ok || !filterOps[f.Op] || f.Op != "" && !numeric {
+			return newSearchError(ErrBadQuery, nil, nil,
+				fmt.Sprintf("filter %s: bad field or operator", f))
+		}
+	}
+	if len(req.Filters) == 0 || selfContained(req.Query) {
+		return nil
+	}
+	return newSearchError(ErrBadQuery, nil, nil,
+		fmt.Sprintf("query %q: unbalanced parentheses or quotes", req.Query))
+}
+
+// selfContained сообщает, что все кавычки в q закрыты, а скобки вне кавычек
+// сбалансированы.
+func selfContained(q string) bool {
+	depth, quoted := 0, false
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return false
+			}
+			depth--
+		}
+	}
+	return depth == 0 && !quoted
+}
+
+// query собирает Query и Filters в параметр query для SearchServer.
+func (req *SearchRequest) query() string {
+	if len(req.Filters) == 0 {
+		return req.Query
+	}
+	parts := make([]string, 0, len(req.Filters)+1)
+	if strings.TrimSpace(req.Query) != "" {
+		parts = append(parts, "("+req.Query+")")
+	}
+	for _, f := range req.Filters {
+		parts = append(parts, f.String())
+	}
+	return strings.Join(parts, " ")
+}
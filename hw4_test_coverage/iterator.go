@@ -0,0 +1,144 @@
+package main
+
+import "context"
+
+// UserIterator читает все найденные пользователи постранично:
+//
+//	it := client.AllUsers(ctx, SearchRequest{Query: "Boyd"})
+//	defer it.Close()
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type UserIterator struct {
+	srv    *SearchClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    SearchRequest
+
+	users []User
+	pos   int
+	user  User
+	last  bool
+	err   error
+
+	// pages - страницы от горутины предзагрузки, если включён Prefetch;
+	// done закрывается, когда она завершилась
+	pages chan userPage
+	done  chan struct{}
+}
+
+type userPage struct {
+	resp *SearchResponse
+	err  error
+}
+
+// AllUsers возвращает итератор по всем пользователям, подходящим под req,
+// начиная с req.Offset. req.Limit задаёт размер страницы; 0 и всё, что
+// больше MaxLimit, означает MaxLimit. Итератор останавливается на первой
+// ошибке или при отмене ctx.
+func (srv *SearchClient) AllUsers(ctx context.Context, req SearchRequest) *UserIterator {
+	if req.Limit == 0 || req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	it := &UserIterator{srv: srv, ctx: ctx, cancel: cancel, req: req}
+	if srv.Prefetch {
+		it.pages, it.done = make(chan userPage), make(chan struct{})
+		go it.prefetch()
+	}
+	return it
+}
+
+// Next переходит к следующему пользователю, false - пользователи
+// кончились или случилась ошибка, см. Err.
+func (it *UserIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.fail(err)
+		return false
+	}
+	for it.pos >= len(it.users) {
+		if it.last {
+			return false
+		}
+		page := it.nextPage()
+		if page.err != nil {
+			it.fail(page.err)
+			return false
+		}
+		it.users, it.pos, it.last = page.resp.Users, 0, !page.resp.NextPage
+	}
+	it.user = it.users[it.pos]
+	it.pos++
+	return true
+}
+
+// User возвращает текущего пользователя.
+func (it *UserIterator) User() User {
+	return it.user
+}
+
+// Err возвращает ошибку, на которой остановился итератор.
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// Close останавливает предзагрузку и дожидается её завершения.
+func (it *UserIterator) Close() {
+	it.cancel()
+	if it.done != nil {
+		<-it.done
+	}
+}
+
+func (it *UserIterator) fail(err error) {
+	it.err = err
+	it.cancel()
+}
+
+func (it *UserIterator) nextPage() userPage {
+	if it.pages == nil {
+		return it.fetch()
+	}
+	select {
+	case page := <-it.pages:
+		return page
+	case <-it.ctx.Done():
+		return userPage{err: it.ctx.Err()}
+	}
+}
+
+// fetch запрашивает страницу и сдвигает Offset на полученное число
+// пользователей.
+func (it *UserIterator) fetch() userPage {
+	if err := it.ctx.Err(); err != nil {
+		return userPage{err: err}
+	}
+	resp, err := it.srv.FindUsersContext(it.ctx, it.req)
+	if err != nil {
+		return userPage{err: err}
+	}
+	it.req.Offset += len(resp.Users)
+	return userPage{resp: resp}
+}
+
+// prefetch запрашивает страницы по одной вперёд: следующая загружается,
+// пока Next разбирает предыдущую.
+func (it *UserIterator) prefetch() {
+	defer close(it.done)
+	for {
+		page := it.fetch()
+		select {
+		case it.pages <- page:
+		case <-it.ctx.Done():
+			return
+		}
+		if page.err != nil || !page.resp.NextPage {
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - повторы запроса при таймаутах и ответах 5xx. Пауза перед
+// повтором растёт вдвое с каждой попыткой, начиная с BaseDelay и не больше
+// MaxDelay, и выбирается случайно между половиной и полным значением, чтобы
+// клиенты не повторяли запросы одновременно. Если сервер прислал
+// Retry-After, ждём столько, сколько он просит, а если он просит больше
+// MaxDelay, не повторяем и возвращаем его ответ.
+type RetryPolicy struct {
+	// Attempts - сколько всего попыток, 0 и 1 - без повторов
+	Attempts int
+	// BaseDelay - пауза перед второй попыткой, по умолчанию defaultRetryBaseDelay
+	BaseDelay time.Duration
+	// MaxDelay - предел паузы, по умолчанию defaultRetryMaxDelay
+	MaxDelay time.Duration
+}
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+)
+
+func (p RetryPolicy) attempts() int {
+	if p.Attempts < 1 {
+		return 1
+	}
+	return p.Attempts
+}
+
+// delay - пауза после неудачной попытки attempt (считая с 1); false -
+// сервер просит ждать дольше MaxDelay.
+func (p RetryPolicy) delay(attempt int, header http.Header) (time.Duration, bool) {
+	max := p.MaxDelay
+	if max <= 0 {
+		max = defaultRetryMaxDelay
+	}
+	if d, ok := retryAfter(header); ok {
+		return d, d <= max
+	}
+
+	base := p.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// retryAfter разбирает заголовок Retry-After: число секунд или дата.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	val := header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(val); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext ждёт d или отмены ctx.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
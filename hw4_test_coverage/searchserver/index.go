@@ -0,0 +1,188 @@
+package searchserver
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Сортировка по релевантности. Name и About разбиваются на слова, слова
+// приводятся к основе (stem), и для каждого поля строится обратный индекс:
+// основа -> пользователи, у которых она есть, и сколько раз. Запрос
+// оценивается по BM25 по текстовым термам query (без поля, name:, about:);
+// фраза считается набором отдельных слов. Совпадение в Name весит вдвое
+// больше, чем в About. Кроме того, с Relevance текстовый терм подходит не
+// только по подстроке, но и когда в поле есть основы всех его слов: runs
+// находит running. Такие пользователи берутся из того же индекса.
+
+// параметры BM25
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	nameWeight  = 2
+	aboutWeight = 1
+)
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// fieldIndex - обратный индекс одного поля.
+type fieldIndex struct {
+	// postings[основа] - по возрастанию doc
+	postings map[string][]posting
+	// lengths[doc] - число слов в поле
+	lengths []int
+	avgLen  float64
+}
+
+func newFieldIndex(texts []string) *fieldIndex {
+	f := &fieldIndex{
+		postings: make(map[string][]posting),
+		lengths:  make([]int, len(texts)),
+	}
+	total := 0
+	for doc, text := range texts {
+		tokens := tokenize(text)
+		f.lengths[doc] = len(tokens)
+		total += len(tokens)
+		for _, token := range tokens {
+			list := f.postings[token]
+			if n := len(list); n > 0 && list[n-1].doc == doc {
+				list[n-1].tf++
+				continue
+			}
+			f.postings[token] = append(list, posting{doc: doc, tf: 1})
+		}
+	}
+	if len(texts) > 0 {
+		f.avgLen = float64(total) / float64(len(texts))
+	}
+	return f
+}
+
+// score добавляет в scores вклад основы token, умноженный на weight.
+func (f *fieldIndex) score(token string, weight float64, scores []float64) {
+	list := f.postings[token]
+	if len(list) == 0 {
+		return
+	}
+	n, df := float64(len(f.lengths)), float64(len(list))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	for _, p := range list {
+		tf := float64(p.tf)
+		norm := 1 - bm25B + bm25B*float64(f.lengths[p.doc])/f.avgLen
+		scores[p.doc] += weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+}
+
+// tokenize разбивает текст на слова из букв и цифр и приводит их к основе.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = stem(word)
+	}
+	return words
+}
+
+// relevance возвращает BM25 запроса q для каждого пользователя.
+func (s *Server) relevance(q queryNode) []float64 {
+	scores := make([]float64, len(s.docs))
+	for _, t := range textTerms(q) {
+		for _, token := range tokenize(t.value) {
+			if t.name {
+				s.nameIndex.score(token, nameWeight, scores)
+			}
+			if t.about {
+				s.aboutIndex.score(token, aboutWeight, scores)
+			}
+		}
+	}
+	return scores
+}
+
+// stemTerm - textTerm для запросов с Relevance: docs[pos] - у пользователя
+// в полях терма есть основы всех слов value.
+type stemTerm struct {
+	textTerm
+	docs []bool
+}
+
+func (t stemTerm) match(d *doc) bool {
+	return t.docs[d.pos] || t.textTerm.match(d)
+}
+
+// stemQuery заменяет текстовые термы q на stemTerm.
+func (s *Server) stemQuery(q queryNode) queryNode {
+	switch n := q.(type) {
+	case queryAnd:
+		res := make(queryAnd, len(n))
+		for i, child := range n {
+			res[i] = s.stemQuery(child)
+		}
+		return res
+	case queryOr:
+		res := make(queryOr, len(n))
+		for i, child := range n {
+			res[i] = s.stemQuery(child)
+		}
+		return res
+	case textTerm:
+		return stemTerm{textTerm: n, docs: s.stemDocs(n)}
+	}
+	return q
+}
+
+// stemDocs отмечает пользователей, у которых в Name или About (смотря по
+// терму) есть основы всех слов t.value.
+func (s *Server) stemDocs(t textTerm) []bool {
+	docs := make([]bool, len(s.docs))
+	tokens := make(map[string]bool)
+	for _, token := range tokenize(t.value) {
+		tokens[token] = true
+	}
+	if len(tokens) == 0 {
+		return docs
+	}
+	var fields []*fieldIndex
+	if t.name {
+		fields = append(fields, s.nameIndex)
+	}
+	if t.about {
+		fields = append(fields, s.aboutIndex)
+	}
+	for _, f := range fields {
+		found := make([]int, len(s.docs))
+		for token := range tokens {
+			for _, p := range f.postings[token] {
+				if found[p.doc]++; found[p.doc] == len(tokens) {
+					docs[p.doc] = true
+				}
+			}
+		}
+	}
+	return docs
+}
+
+// relevanceOrder - номера пользователей по возрастанию релевантности, при
+// равенстве - по убыванию Id, чтобы в OrderByDesc равные шли по Id.
+func (s *Server) relevanceOrder(q queryNode) []int {
+	scores := s.relevance(q)
+	order := make([]int, len(s.docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if scores[a] != scores[b] {
+			return scores[a] < scores[b]
+		}
+		return s.users[a].Id > s.users[b].Id
+	})
+	return order
+}
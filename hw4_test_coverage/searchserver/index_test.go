@@ -0,0 +1,144 @@
+package searchserver
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Hopping, HOPPED & hops; 42-nd café\n")
+	expected := []string{"hop", "hop", "hop", "42", "nd", "café"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestBM25(t *testing.T) {
+	f := newFieldIndex([]string{"apple apple banana", "apples cherry", "cherry cherry cherry durian", ""})
+	scores := make([]float64, 4)
+	f.score("appl", 1, scores)
+
+	// N = 4, df = 2, средняя длина 9/4
+	idf := math.Log(1 + (4-2+0.5)/(2+0.5))
+	doc1 := idf * 1 * 2.2 / (1 + 1.2*(0.25+0.75*2/2.25))
+	if math.Abs(scores[1]-doc1) > 1e-9 {
+		t.Errorf("doc 1: got %v, expected %v", scores[1], doc1)
+	}
+	if !(scores[0] > scores[1] && scores[2] == 0 && scores[3] == 0) {
+		t.Errorf("bad scores %v", scores)
+	}
+
+	// редкое слово весит больше частого
+	rare, common := make([]float64, 4), make([]float64, 4)
+	f.score("durian", 1, rare)
+	f.score("cherri", 1, common)
+	if rare[2] <= common[1] {
+		t.Errorf("rare %v <= common %v", rare[2], common[1])
+	}
+	f.score("nosuchword", 1, rare)
+	if rare[2] == 0 || rare[0] != 0 {
+		t.Errorf("unknown word changed scores: %v", rare)
+	}
+}
+
+func TestRelevance(t *testing.T) {
+	srv, err := NewFromFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := parseQuery("about:laborum OR lorem")
+	scores := srv.relevance(q)
+	score := make(map[int]float64)
+	for i, u := range srv.users {
+		score[u.Id] = scores[i]
+	}
+
+	_, best, _ := search(t, srv, "query=about:laborum+OR+lorem&order_field=Relevance", "")
+	if len(best) < 2 {
+		t.Fatalf("too few results: %d", len(best))
+	}
+	if !sort.SliceIsSorted(best, func(i, j int) bool {
+		a, b := best[i], best[j]
+		return score[a.Id] > score[b.Id] || score[a.Id] == score[b.Id] && a.Id < b.Id
+	}) {
+		t.Errorf("not sorted by relevance: %v", best)
+	}
+	if score[best[0].Id] <= score[best[len(best)-1].Id] {
+		t.Errorf("all scores are equal")
+	}
+
+	_, desc, _ := search(t, srv, "query=about:laborum+OR+lorem&order_field=Relevance&order_by=1", "")
+	if !reflect.DeepEqual(desc, best) {
+		t.Errorf("order_by=1 differs from default")
+	}
+	_, asc, _ := search(t, srv, "query=about:laborum+OR+lorem&order_field=Relevance&order_by=-1", "")
+	for i := range asc {
+		if asc[i] != best[len(best)-1-i] {
+			t.Fatalf("asc is not reversed desc at %d", i)
+		}
+	}
+
+	var paged []User
+	for offset := 0; offset < len(best); offset += 4 {
+		_, page, _ := search(t, srv, "query=about:laborum+OR+lorem&order_field=Relevance&limit=4&offset="+strconv.Itoa(offset), "")
+		paged = append(paged, page...)
+	}
+	if !reflect.DeepEqual(paged, best) {
+		t.Errorf("pages do not add up to ranked list")
+	}
+
+	// без текстовых термов все равны - порядок по Id
+	_, byID, _ := search(t, srv, "query=age:>30&order_field=Relevance", "")
+	_, expected, _ := search(t, srv, "query=age:>30&order_field=Id&order_by=-1", "")
+	if len(byID) == 0 || !reflect.DeepEqual(byID, expected) {
+		t.Errorf("without text terms expected Id order")
+	}
+
+	// совпадение в имени важнее, чем в about
+	names := New([]User{
+		{Id: 1, Name: "Ann Smith", About: "boyd wolf"},
+		{Id: 2, Name: "Boyd Wolf", About: "something else"},
+	})
+	if code, users, _ := search(t, names, "query=boyd+wolf&order_field=Relevance", ""); code != http.StatusOK || users[0].Id != 2 {
+		t.Errorf("name match is not first: %v", users)
+	}
+}
+
+func TestRelevanceStems(t *testing.T) {
+	srv := New([]User{
+		{Id: 1, Name: "Ann Smith", About: "likes running and swimming"},
+		{Id: 2, Name: "Boyd Wolf", About: "runs every day"},
+		{Id: 3, Name: "Hilda Mayer", About: "reads books"},
+		{Id: 4, Name: "Runner Swims", About: "nothing"},
+	})
+	ids := func(query string) []int {
+		code, users, _ := search(t, srv, query, "")
+		if code != http.StatusOK {
+			t.Fatalf("%s: status %d", query, code)
+		}
+		res := []int{}
+		for _, u := range users {
+			res = append(res, u.Id)
+		}
+		sort.Ints(res)
+		return res
+	}
+	for query, expected := range map[string][]int{
+		// без Relevance - только подстрока
+		"query=runs":                       {2},
+		"query=runs&order_field=Relevance": {1, 2},
+		"query=about:swim+OR+name:runners&order_field=Relevance": {1, 4},
+		"query=%22running+swims%22&order_field=Relevance":        {1},
+		"query=name:runs&order_field=Relevance":                  {},
+		"query=runs+gender:male&order_field=Relevance":           {},
+		"query=%22+%22&order_field=Relevance":                    {1, 2, 3, 4},
+	} {
+		if got := ids(query); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got %v, expected %v", query, got, expected)
+		}
+	}
+}
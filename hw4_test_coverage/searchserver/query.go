@@ -0,0 +1,332 @@
+package searchserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Синтаксис параметра query:
+//
+//	boyd                   подстрока в Name или About
+//	"boyd wolf"            фраза с пробелами, \" и \\ внутри кавычек
+//	name:boyd about:"sit amet"
+//	gender:female          точное совпадение
+//	age:>30 age:<=40 id:7  сравнение чисел: =, >, >=, <, <=
+//	a b, a AND b           оба условия
+//	a OR b                 хотя бы одно, AND связывает сильнее OR
+//	(a OR b) c             скобки
+//
+// Текст сравнивается без учёта регистра, AND и OR - только заглавными.
+// Пустой query подходит всем.
+
+// QueryError - ошибка разбора query, Pos - смещение в байтах.
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at %d", e.Msg, e.Pos)
+}
+
+// doc - пользователь с заранее приведёнными к нижнему регистру полями,
+// pos - его номер в Server.users.
+type doc struct {
+	user  *User
+	pos   int
+	name  string
+	about string
+}
+
+func newDoc(u *User, pos int) doc {
+	return doc{user: u, pos: pos, name: strings.ToLower(u.Name), about: strings.ToLower(u.About)}
+}
+
+type queryNode interface {
+	match(d *doc) bool
+}
+
+type queryAnd []queryNode
+
+func (q queryAnd) match(d *doc) bool {
+	for _, node := range q {
+		if !node.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+type queryOr []queryNode
+
+func (q queryOr) match(d *doc) bool {
+	for _, node := range q {
+		if node.match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// textTerm ищет подстроку в name и/или about.
+type textTerm struct {
+	name, about bool
+	value       string
+}
+
+func (t textTerm) match(d *doc) bool {
+	return t.name && strings.Contains(d.name, t.value) ||
+		t.about && strings.Contains(d.about, t.value)
+}
+
+// textTerms собирает текстовые термы запроса, по ним считается релевантность.
+func textTerms(node queryNode) []textTerm {
+	var terms []textTerm
+	switch n := node.(type) {
+	case queryAnd:
+		for _, child := range n {
+			terms = append(terms, textTerms(child)...)
+		}
+	case queryOr:
+		for _, child := range n {
+			terms = append(terms, textTerms(child)...)
+		}
+	case textTerm:
+		terms = append(terms, n)
+	}
+	return terms
+}
+
+type genderTerm string
+
+func (t genderTerm) match(d *doc) bool {
+	return strings.EqualFold(d.user.Gender, string(t))
+}
+
+// numTerm сравнивает Age или Id с числом.
+type numTerm struct {
+	field func(u *User) int
+	op    string
+	value int
+}
+
+func (t numTerm) match(d *doc) bool {
+	n := t.field(d.user)
+	switch t.op {
+	case ">":
+		return n > t.value
+	case ">=":
+		return n >= t.value
+	case "<":
+		return n < t.value
+	case "<=":
+		return n <= t.value
+	}
+	return n == t.value
+}
+
+var numFields = map[string]func(u *User) int{
+	"age": func(u *User) int { return u.Age },
+	"id":  func(u *User) int { return u.Id },
+}
+
+// операторы, длинные раньше коротких
+var queryOps = []string{">=", "<=", ">", "<", "="}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func parseQuery(src string) (queryNode, error) {
+	if strings.TrimSpace(src) == "" {
+		return queryAnd{}, nil
+	}
+	p := &queryParser{src: src}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return node, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return &QueryError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isWordEnd - символы, на которых заканчивается слово без кавычек.
+func isWordEnd(c byte) bool {
+	return isSpace(c) || c == '(' || c == ')' || c == '"'
+}
+
+// atKeyword сообщает, стоит ли в текущей позиции слово kw: AND или OR.
+func (p *queryParser) atKeyword(kw string) bool {
+	end := p.pos + len(kw)
+	return strings.HasPrefix(p.src[p.pos:], kw) && (end == len(p.src) || isWordEnd(p.src[end]))
+}
+
+// atEnd - дальше нет терма: конец строки, ) или OR.
+func (p *queryParser) atEnd() bool {
+	return p.pos == len(p.src) || p.src[p.pos] == ')' || p.atKeyword("OR")
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var or queryOr
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+		if !p.atKeyword("OR") {
+			break
+		}
+		p.pos += len("OR")
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var and queryAnd
+	for {
+		p.skipSpace()
+		if p.atEnd() {
+			break
+		}
+		if p.atKeyword("AND") {
+			p.pos += len("AND")
+			p.skipSpace()
+			if len(and) == 0 || p.atEnd() {
+				return nil, p.errorf("AND needs terms on both sides")
+			}
+		}
+		node, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, node)
+	}
+	switch len(and) {
+	case 0:
+		return nil, p.errorf("expected term")
+	case 1:
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	if p.src[p.pos] != '(' {
+		return p.parseTerm()
+	}
+	p.pos++
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.src) {
+		return nil, p.errorf("expected )")
+	}
+	p.pos++
+	return node, nil
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	start := p.pos
+	if p.src[p.pos] == '"' {
+		value, err := p.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		return textTerm{name: true, about: true, value: strings.ToLower(value)}, nil
+	}
+	word := p.parseWord()
+	colon := strings.IndexByte(word, ':')
+	if colon < 0 {
+		return textTerm{name: true, about: true, value: strings.ToLower(word)}, nil
+	}
+
+	field, value := word[:colon], word[colon+1:]
+	op := ""
+	for _, o := range queryOps {
+		if strings.HasPrefix(value, o) {
+			op, value = o, value[len(o):]
+			break
+		}
+	}
+	if value == "" && p.pos < len(p.src) && p.src[p.pos] == '"' {
+		var err error
+		if value, err = p.parsePhrase(); err != nil {
+			return nil, err
+		}
+	} else if value == "" {
+		return nil, p.errorf("expected value for %s", field)
+	}
+
+	if get, ok := numFields[field]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &QueryError{Pos: start, Msg: fmt.Sprintf("%s: bad number %q", field, value)}
+		}
+		return numTerm{field: get, op: op, value: n}, nil
+	}
+	if op != "" {
+		return nil, &QueryError{Pos: start, Msg: fmt.Sprintf("%s: operator %s is only for numbers", field, op)}
+	}
+	switch field {
+	case "name":
+		return textTerm{name: true, value: strings.ToLower(value)}, nil
+	case "about":
+		return textTerm{about: true, value: strings.ToLower(value)}, nil
+	case "gender":
+		return genderTerm(value), nil
+	}
+	return nil, &QueryError{Pos: start, Msg: fmt.Sprintf("unknown field %q", field)}
+}
+
+func (p *queryParser) parseWord() string {
+	start := p.pos
+	for p.pos < len(p.src) && !isWordEnd(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parsePhrase читает строку в кавычках, p.src[p.pos] == '"'.
+func (p *queryParser) parsePhrase() (string, error) {
+	start := p.pos
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.src); p.pos++ {
+		switch c := p.src[p.pos]; c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if p.pos+1 < len(p.src) {
+				p.pos++
+				c = p.src[p.pos]
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", &QueryError{Pos: start, Msg: "unterminated phrase"}
+}
@@ -0,0 +1,87 @@
+package searchserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func lower(s string) string { return strings.ToLower(s) }
+
+func TestParseQuery(t *testing.T) {
+	users, err := Load(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	has := func(u User, s string) bool {
+		return strings.Contains(lower(u.Name), s) || strings.Contains(lower(u.About), s)
+	}
+	cases := []struct {
+		query    string
+		expected func(u User) bool
+	}{
+		{"", func(u User) bool { return true }},
+		{"  ", func(u User) bool { return true }},
+		{"BOYD", func(u User) bool { return has(u, "boyd") }},
+		{"boyd wolf", func(u User) bool { return has(u, "boyd") && has(u, "wolf") }},
+		{`"Boyd Wolf"`, func(u User) bool { return u.Name == "Boyd Wolf" }},
+		{`name:"boyd wolf"`, func(u User) bool { return u.Name == "Boyd Wolf" }},
+		{"name:an", func(u User) bool { return strings.Contains(lower(u.Name), "an") }},
+		{"about:nulla", func(u User) bool { return strings.Contains(lower(u.About), "nulla") }},
+		{"gender:FEMALE", func(u User) bool { return u.Gender == "female" }},
+		{"age:>30", func(u User) bool { return u.Age > 30 }},
+		{"age:>=30", func(u User) bool { return u.Age >= 30 }},
+		{"age:<30", func(u User) bool { return u.Age < 30 }},
+		{"age:<=30", func(u User) bool { return u.Age <= 30 }},
+		{"age:=22 OR id:7", func(u User) bool { return u.Age == 22 || u.Id == 7 }},
+		{`id:"7"`, func(u User) bool { return u.Id == 7 }},
+		{"gender:male AND age:>30 OR id:0", func(u User) bool { return u.Gender == "male" && u.Age > 30 || u.Id == 0 }},
+		{"gender:male (age:>30 OR id:0)", func(u User) bool { return u.Gender == "male" && (u.Age > 30 || u.Id == 0) }},
+		{"(name:boyd)", func(u User) bool { return strings.Contains(lower(u.Name), "boyd") }},
+		{"android OR and", func(u User) bool { return has(u, "android") || has(u, "and") }},
+		{`"say \"hi\" \\"`, func(u User) bool { return has(u, `say "hi" \`) }},
+	}
+	for _, c := range cases {
+		q, err := parseQuery(c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		matched := 0
+		for i := range users {
+			d := newDoc(&users[i], i)
+			if got := q.match(&d); got != c.expected(users[i]) {
+				t.Errorf("%s: user %d: expected %v", c.query, users[i].Id, !got)
+			}
+			if c.expected(users[i]) {
+				matched++
+			}
+		}
+		if matched == 0 && c.query != `"say \"hi\" \\"` {
+			t.Errorf("%s: matches nobody, test is useless", c.query)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for query, pos := range map[string]int{
+		"(boyd":         5,
+		"boyd)":         4,
+		"()":            1,
+		"boyd OR":       7,
+		"OR boyd":       0,
+		"AND boyd":      4,
+		"boyd AND":      8,
+		"boyd AND OR x": 9,
+		`"boyd`:         0,
+		`name:"boyd`:    5,
+		"name:":         5,
+		"age:x":         0,
+		"x name:>a":     2,
+		"color:red":     0,
+	} {
+		_, err := parseQuery(query)
+		if qe, ok := err.(*QueryError); !ok || qe.Pos != pos {
+			t.Errorf("%s: expected error at %d, got %v", query, pos, err)
+		}
+	}
+}
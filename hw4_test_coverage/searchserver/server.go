@@ -0,0 +1,271 @@
+// Package searchserver - внешняя система поиска пользователей, в которую
+// ходит SearchClient. Данные из dataset.xml читаются один раз при старте.
+//
+//	GET /?query=Boyd&order_field=Age&order_by=1&offset=0&limit=10
+//
+// query - условия на поля пользователя, синтаксис описан в query.go; без
+// полей слово ищется в Name (first_name + " " + last_name) и About.
+// order_field - Id, Age, Name (по умолчанию) или Relevance, order_by -
+// OrderByAsc, OrderByAsIs или OrderByDesc. Relevance упорядочивает по BM25
+// текстовых термов query (см. index.go): без order_by и с OrderByDesc самые
+// релевантные идут первыми, с OrderByAsc - последними. С Relevance текстовый
+// терм находит и другие формы слова: runs - running. Сначала отбираются
+// и сортируются все подходящие пользователи, потом берётся страница offset,
+// limit. Ответ - JSON-массив пользователей, ошибка - {"error": "..."}
+// с кодом 400, для ErrorBadQuery в поле detail - что не так с query.
+package searchserver
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+)
+
+// Ошибки в поле error ответа 400.
+const (
+	ErrorBadOrderField = "ErrorBadOrderField"
+	ErrorBadOrderBy    = "ErrorBadOrderBy"
+	ErrorBadLimit      = "ErrorBadLimit"
+	ErrorBadOffset     = "ErrorBadOffset"
+	ErrorBadQuery      = "ErrorBadQuery"
+)
+
+// Значения order_field.
+const (
+	OrderFieldId        = "Id"
+	OrderFieldAge       = "Age"
+	OrderFieldName      = "Name"
+	OrderFieldRelevance = "Relevance"
+)
+
+type User struct {
+	Id     int
+	Name   string
+	Age    int
+	About  string
+	Gender string
+}
+
+// Load читает пользователей из XML в формате dataset.xml.
+func Load(path string) ([]User, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data struct {
+		Rows []struct {
+			Id        int    `xml:"id"`
+			Age       int    `xml:"age"`
+			About     string `xml:"about"`
+			Gender    string `xml:"gender"`
+			FirstName string `xml:"first_name"`
+			LastName  string `xml:"last_name"`
+		} `xml:"row"`
+	}
+	if err := xml.NewDecoder(file).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	users := make([]User, len(data.Rows))
+	for i, row := range data.Rows {
+		users[i] = User{
+			Id:     row.Id,
+			Name:   row.FirstName + " " + row.LastName,
+			Age:    row.Age,
+			About:  row.About,
+			Gender: row.Gender,
+		}
+	}
+	return users, nil
+}
+
+// Server отвечает на запросы SearchClient. Для каждого поля сортировки
+// порядок пользователей считается заранее, так что запрос - это один
+// проход по готовому порядку.
+type Server struct {
+	users []User
+	docs  []doc
+	// orders[field] - номера пользователей по возрастанию field,
+	// при равенстве - по Id
+	orders map[string][]int
+	tokens map[string]bool
+
+	nameIndex, aboutIndex *fieldIndex
+}
+
+// New создаёт сервер по пользователям. Если tokens не пустой, запросы без
+// заголовка AccessToken из этого списка получают 401.
+func New(users []User, tokens ...string) *Server {
+	s := &Server{
+		users:  users,
+		docs:   make([]doc, len(users)),
+		orders: make(map[string][]int),
+		tokens: make(map[string]bool),
+	}
+	for _, token := range tokens {
+		s.tokens[token] = true
+	}
+	names := make([]string, len(users))
+	abouts := make([]string, len(users))
+	for i := range users {
+		s.docs[i] = newDoc(&users[i], i)
+		names[i], abouts[i] = users[i].Name, users[i].About
+	}
+	s.nameIndex = newFieldIndex(names)
+	s.aboutIndex = newFieldIndex(abouts)
+
+	fields := map[string]func(a, b *User) bool{
+		OrderFieldId:   func(a, b *User) bool { return a.Id < b.Id },
+		OrderFieldAge:  func(a, b *User) bool { return a.Age < b.Age },
+		OrderFieldName: func(a, b *User) bool { return a.Name < b.Name },
+	}
+	for field, less := range fields {
+		less := less
+		order := make([]int, len(users))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := &users[order[i]], &users[order[j]]
+			if less(a, b) != less(b, a) {
+				return less(a, b)
+			}
+			return a.Id < b.Id
+		})
+		s.orders[field] = order
+	}
+	return s
+}
+
+// NewFromFile - New по пользователям из файла path.
+func NewFromFile(path string, tokens ...string) (*Server, error) {
+	users, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(users, tokens...), nil
+}
+
+type request struct {
+	query      queryNode
+	orderField string
+	orderBy    int
+	offset     int
+	limit      int
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.tokens) > 0 && !s.tokens[r.Header.Get("AccessToken")] {
+		writeError(w, http.StatusUnauthorized, "bad AccessToken", "")
+		return
+	}
+	req, errMsg, detail := parseRequest(r)
+	if errMsg != "" {
+		writeError(w, http.StatusBadRequest, errMsg, detail)
+		return
+	}
+	order, ok := s.orders[req.orderField]
+	if req.orderField == OrderFieldRelevance {
+		order, ok = s.relevanceOrder(req.query), true
+		req.query = s.stemQuery(req.query)
+		if req.orderBy == OrderByAsIs {
+			req.orderBy = OrderByDesc
+		}
+	}
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrorBadOrderField, "")
+		return
+	}
+
+	result := []User{}
+	skip := req.offset
+	for i := range s.docs {
+		if len(result) == req.limit {
+			break
+		}
+		var d *doc
+		switch req.orderBy {
+		case OrderByAsc:
+			d = &s.docs[order[i]]
+		case OrderByDesc:
+			d = &s.docs[order[len(order)-1-i]]
+		default:
+			d = &s.docs[i]
+		}
+		if !req.query.match(d) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		result = append(result, *d.user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseRequest разбирает параметры; без limit возвращаются все
+// подходящие пользователи, без offset и order_by - 0 и OrderByAsIs.
+// Вторым значением возвращается ошибка, третьим - подробности к ней.
+func parseRequest(r *http.Request) (request, string, string) {
+	params := r.URL.Query()
+	req := request{
+		orderField: params.Get("order_field"),
+		limit:      -1,
+	}
+	if req.orderField == "" {
+		req.orderField = OrderFieldName
+	}
+
+	var ok bool
+	if req.limit, ok = intParam(params.Get("limit"), -1); !ok {
+		return req, ErrorBadLimit, ""
+	}
+	if req.offset, ok = intParam(params.Get("offset"), 0); !ok {
+		return req, ErrorBadOffset, ""
+	}
+	if val := params.Get("order_by"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < OrderByAsc || n > OrderByDesc {
+			return req, ErrorBadOrderBy, ""
+		}
+		req.orderBy = n
+	}
+	query, err := parseQuery(params.Get("query"))
+	if err != nil {
+		return req, ErrorBadQuery, err.Error()
+	}
+	req.query = query
+	return req, "", ""
+}
+
+// intParam разбирает неотрицательное число, пустое значение - defaultVal.
+func intParam(val string, defaultVal int) (int, bool) {
+	if val == "" {
+		return defaultVal, true
+	}
+	n, err := strconv.Atoi(val)
+	return n, err == nil && n >= 0
+}
+
+func writeError(w http.ResponseWriter, code int, msg, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error  string `json:"error"`
+		Detail string `json:"detail,omitempty"`
+	}{msg, detail})
+}
@@ -0,0 +1,163 @@
+package searchserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const datasetPath = "../dataset.xml"
+
+func search(t *testing.T, h http.Handler, query string, token string) (int, []User, string) {
+	r := httptest.NewRequest("GET", "/?"+query, nil)
+	if token != "" {
+		r.Header.Set("AccessToken", token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		errResp := struct{ Error string }{}
+		json.Unmarshal(w.Body.Bytes(), &errResp)
+		return w.Code, nil, errResp.Error
+	}
+	var users []User
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, users, ""
+}
+
+func TestSortBeforePaginate(t *testing.T) {
+	srv, err := NewFromFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, _ := Load(datasetPath)
+
+	_, all, _ := search(t, srv, "order_field=Age&order_by=-1", "")
+	if len(all) != len(users) {
+		t.Fatalf("expected %d users, got %d", len(users), len(all))
+	}
+	if !sort.SliceIsSorted(all, func(i, j int) bool {
+		return all[i].Age < all[j].Age || all[i].Age == all[j].Age && all[i].Id < all[j].Id
+	}) {
+		t.Errorf("not sorted by Age: %v", all)
+	}
+
+	var paged []User
+	for offset := 0; offset < len(users); offset += 7 {
+		_, page, _ := search(t, srv, "order_field=Age&order_by=-1&limit=7&offset="+strconv.Itoa(offset), "")
+		paged = append(paged, page...)
+	}
+	if !reflect.DeepEqual(paged, all) {
+		t.Errorf("pages do not add up to sorted list")
+	}
+
+	_, desc, _ := search(t, srv, "order_field=Age&order_by=1", "")
+	for i := range desc {
+		if desc[i] != all[len(all)-1-i] {
+			t.Fatalf("desc is not reversed asc at %d", i)
+		}
+	}
+
+	_, asIs, _ := search(t, srv, "order_field=Id", "")
+	if !reflect.DeepEqual(asIs, users) {
+		t.Errorf("order_by=0 changed dataset order")
+	}
+	_, byName, _ := search(t, srv, "order_by=-1&limit=2", "")
+	if len(byName) != 2 || byName[0].Name > byName[1].Name {
+		t.Errorf("default order_field is not Name: %v", byName)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	srv, err := NewFromFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, users, _ := search(t, srv, "query=Boyd+Wolf", ""); len(users) != 1 || users[0].Id != 0 {
+		t.Errorf("name search failed: %v", users)
+	}
+	_, users, _ := search(t, srv, "query=nisi&order_field=Id&order_by=-1", "")
+	for _, u := range users {
+		if !strings.Contains(u.About, "nisi") && !strings.Contains(u.Name, "nisi") {
+			t.Errorf("user %d does not match", u.Id)
+		}
+	}
+	if len(users) == 0 {
+		t.Errorf("about search found nothing")
+	}
+	if _, users, _ := search(t, srv, "query=nosuchuser&limit=0", ""); users == nil || len(users) != 0 {
+		t.Errorf("expected empty array, got %v", users)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	srv := New(nil)
+	for query, expected := range map[string]string{
+		"order_field=Gender": ErrorBadOrderField,
+		"order_by=2":         ErrorBadOrderBy,
+		"order_by=x":         ErrorBadOrderBy,
+		"limit=x":            ErrorBadLimit,
+		"limit=-1":           ErrorBadLimit,
+		"offset=-1":          ErrorBadOffset,
+		"query=(":            ErrorBadQuery,
+	} {
+		if code, _, msg := search(t, srv, query, ""); code != http.StatusBadRequest || msg != expected {
+			t.Errorf("%s: expected 400 %s, got %d %s", query, expected, code, msg)
+		}
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	srv := New([]User{{Id: 1, Name: "A B"}}, "secret", "other")
+	for token, expected := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"wrong":  http.StatusUnauthorized,
+		"secret": http.StatusOK,
+		"other":  http.StatusOK,
+	} {
+		if code, _, _ := search(t, srv, "", token); code != expected {
+			t.Errorf("token %q: expected %d, got %d", token, expected, code)
+		}
+	}
+}
+
+func TestLoadOnce(t *testing.T) {
+	data, err := ioutil.ReadFile(datasetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "searchserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dataset.xml")
+	ioutil.WriteFile(path, data, 0644)
+
+	srv, err := NewFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	if code, users, _ := search(t, srv, "limit=3", ""); code != http.StatusOK || len(users) != 3 {
+		t.Errorf("server reads dataset on request: %d", code)
+	}
+
+	if _, err := NewFromFile(path); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+	ioutil.WriteFile(path, []byte("<root><row>"), 0644)
+	if _, err := NewFromFile(path); err == nil {
+		t.Errorf("expected error for broken xml")
+	}
+}
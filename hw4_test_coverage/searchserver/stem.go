@@ -0,0 +1,207 @@
+package searchserver
+
+// stem возвращает основу английского слова по алгоритму Портера
+// (M.F. Porter, An algorithm for suffix stripping, 1980). Слово должно быть
+// в нижнем регистре; слова короче трёх букв и слова не только из a-z
+// возвращаются как есть.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &stemmer{b: []byte(word)}
+	s.step1ab()
+	s.step1c()
+	s.replaceFirst(step2Rules)
+	s.replaceFirst(step3Rules)
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+}
+
+type stemRule struct {
+	suffix, repl string
+}
+
+// правила шагов 2 и 3: суффикс заменяется, если у основы m > 0;
+// длинные суффиксы стоят раньше своих окончаний
+var step2Rules = []stemRule{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var step3Rules = []stemRule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+// суффиксы шага 4, удаляются при m > 1
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+// cons сообщает, согласная ли b[i]; y - согласная после гласной и в начале.
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// measure - число m в записи [C](VC){m}[V] для b[:n].
+func (s *stemmer) measure(n int) int {
+	m, i := 0, 0
+	for i < n && s.cons(i) {
+		i++
+	}
+	for i < n {
+		for i < n && !s.cons(i) {
+			i++
+		}
+		if i == n {
+			break
+		}
+		m++
+		for i < n && s.cons(i) {
+			i++
+		}
+	}
+	return m
+}
+
+// hasVowel - есть ли гласная в b[:n].
+func (s *stemmer) hasVowel(n int) bool {
+	for i := 0; i < n; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons - b[:n] кончается двумя одинаковыми согласными.
+func (s *stemmer) doubleCons(n int) bool {
+	return n >= 2 && s.b[n-1] == s.b[n-2] && s.cons(n-1)
+}
+
+// cvc - b[:n] кончается на согласная-гласная-согласная, причём последняя
+// не w, x и не y: hop, но не snow.
+func (s *stemmer) cvc(n int) bool {
+	if n < 3 || !s.cons(n-3) || s.cons(n-2) || !s.cons(n-1) {
+		return false
+	}
+	c := s.b[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+// ends возвращает длину основы без suffix или -1.
+func (s *stemmer) ends(suffix string) int {
+	j := len(s.b) - len(suffix)
+	if j < 0 || string(s.b[j:]) != suffix {
+		return -1
+	}
+	return j
+}
+
+func (s *stemmer) setTo(j int, repl string) {
+	s.b = append(s.b[:j], repl...)
+}
+
+// replaceFirst находит первое правило, чей суффикс есть у слова, и
+// применяет его, если у основы m > 0.
+func (s *stemmer) replaceFirst(rules []stemRule) {
+	for _, r := range rules {
+		if j := s.ends(r.suffix); j >= 0 {
+			if s.measure(j) > 0 {
+				s.setTo(j, r.repl)
+			}
+			return
+		}
+	}
+}
+
+// step1ab убирает множественное число, -ed и -ing.
+func (s *stemmer) step1ab() {
+	switch {
+	case s.ends("sses") >= 0, s.ends("ies") >= 0:
+		s.b = s.b[:len(s.b)-2]
+	case s.ends("ss") >= 0:
+	case s.ends("s") >= 0:
+		s.b = s.b[:len(s.b)-1]
+	}
+
+	if j := s.ends("eed"); j >= 0 {
+		if s.measure(j) > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+		return
+	}
+	j := s.ends("ed")
+	if j < 0 {
+		j = s.ends("ing")
+	}
+	if j < 0 || !s.hasVowel(j) {
+		return
+	}
+	s.b = s.b[:j]
+	switch {
+	case s.ends("at") >= 0, s.ends("bl") >= 0, s.ends("iz") >= 0:
+		s.b = append(s.b, 'e')
+	case s.doubleCons(j):
+		if c := s.b[j-1]; c != 'l' && c != 's' && c != 'z' {
+			s.b = s.b[:j-1]
+		}
+	case s.measure(j) == 1 && s.cvc(j):
+		s.b = append(s.b, 'e')
+	}
+}
+
+// step1c заменяет y на i, если в основе есть гласная.
+func (s *stemmer) step1c() {
+	if j := s.ends("y"); j >= 0 && s.hasVowel(j) {
+		s.b[j] = 'i'
+	}
+}
+
+func (s *stemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		j := s.ends(suffix)
+		if j < 0 {
+			continue
+		}
+		if suffix == "ion" && (j == 0 || s.b[j-1] != 's' && s.b[j-1] != 't') {
+			continue
+		}
+		if s.measure(j) > 1 {
+			s.b = s.b[:j]
+		}
+		return
+	}
+}
+
+// step5 убирает конечную e и удваивающуюся l.
+func (s *stemmer) step5() {
+	if j := s.ends("e"); j >= 0 {
+		if m := s.measure(j); m > 1 || m == 1 && !s.cvc(j) {
+			s.b = s.b[:j]
+		}
+	}
+	if n := len(s.b); s.b[n-1] == 'l' && s.doubleCons(n) && s.measure(n) > 1 {
+		s.b = s.b[:n-1]
+	}
+}